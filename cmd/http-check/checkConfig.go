@@ -1,68 +1,155 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"math"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/kuberhealthy/http-check/pkg/httpcheck"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
-	// defaultCount is used when COUNT is unset.
-	defaultCount = 0
-	// defaultSeconds is used when SECONDS is unset.
-	defaultSeconds = 0
-	// defaultPassingPercent is used when PASSING_PERCENT is unset.
-	defaultPassingPercent = 100
-	// defaultRequestType is used when REQUEST_TYPE is unset.
-	defaultRequestType = "GET"
-	// defaultRequestBody is used when REQUEST_BODY is unset.
-	defaultRequestBody = "{}"
-	// defaultExpectedStatusCode is used when EXPECTED_STATUS_CODE is unset.
-	defaultExpectedStatusCode = 200
+	// defaultLogFormat is used when LOG_FORMAT is unset.
+	defaultLogFormat = logFormatText
+	// defaultHealthMaxAgeSeconds is how long the check loop may go without
+	// completing a check before the liveness endpoint fails.
+	defaultHealthMaxAgeSeconds = 300
+	// defaultReportTimeoutSeconds is how long a report to Kuberhealthy may
+	// take before the checker gives up.
+	defaultReportTimeoutSeconds = 30
+	// formContentType is the content type REQUEST_FORM selects.
+	formContentType = "application/x-www-form-urlencoded"
 )
 
-// CheckConfig stores configuration for the HTTP check.
+// supportedMethods lists the HTTP methods accepted for REQUEST_TYPE.
+var supportedMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// tlsVersions maps the accepted MIN_TLS_VERSION values to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ipVersions maps the accepted IP_VERSION values to address families.
+var ipVersions = map[string]int{
+	"auto": 0,
+	"4":    4,
+	"6":    6,
+}
+
+// CheckConfig stores the check settings along with the settings that only
+// apply to the command.
 type CheckConfig struct {
-	// CheckURL is the URL to query.
-	CheckURL string
-	// Count is the number of requests to perform.
-	Count int
-	// Seconds is the pause between requests.
-	Seconds int
-	// PassingPercent is the percent of successful responses required.
-	PassingPercent int
-	// RequestType is the HTTP method to use.
-	RequestType string
-	// RequestBody is the body payload for non-GET requests.
-	RequestBody string
-	// ExpectedStatusCode is the HTTP status code to expect.
-	ExpectedStatusCode int
-}
-
-// parseConfig loads environment variables into a CheckConfig.
-func parseConfig() (*CheckConfig, error) {
+	// Config holds the settings passed to httpcheck.Run.
+	*httpcheck.Config
+	// MetricsPort serves Prometheus metrics on /metrics when non-zero.
+	MetricsPort int
+	// LogFormat selects text or JSON log output.
+	LogFormat string
+	// LogLevel is the minimum level of log entries that are written.
+	LogLevel log.Level
+	// DryRun logs the resolved configuration and exits without running checks.
+	DryRun bool
+	// HealthPort serves a liveness endpoint on /healthz when non-zero.
+	HealthPort int
+	// HealthMaxAgeSeconds is how long the check loop may go without
+	// completing a check before the liveness endpoint fails.
+	HealthMaxAgeSeconds int
+	// ExitCodeOnFailure is the process exit code after reporting a failure.
+	ExitCodeOnFailure int
+	// SummaryJSON prints a JSON summary of the run to stdout when set.
+	SummaryJSON bool
+	// NotifyWebhookURL receives a JSON summary of a failed run when set.
+	NotifyWebhookURL *url.URL
+	// MaxP95Ms fails the run when the 95th percentile response time exceeds
+	// this many milliseconds. Zero disables the SLO.
+	MaxP95Ms int
+	// MaxP99Ms fails the run when the 99th percentile response time exceeds
+	// this many milliseconds. Zero disables the SLO.
+	MaxP99Ms int
+	// RequireKHEndpoint fails the run before any check when the Kuberhealthy
+	// endpoint cannot be reached.
+	RequireKHEndpoint bool
+	// FailFastOnDNS fails the run before any check when a CHECK_URL host
+	// cannot be resolved.
+	FailFastOnDNS bool
+	// ReportTimeoutSeconds bounds each report to Kuberhealthy. Zero waits
+	// indefinitely.
+	ReportTimeoutSeconds int
+	// RedactRequestBody hides RequestBody from the dry run because
+	// environment variables, which may hold secrets, were expanded into it.
+	RedactRequestBody bool
+}
+
+// parseConfig loads command-line flags, environment variables, and the
+// optional config file into a CheckConfig.
+func parseConfig(args []string) (*CheckConfig, error) {
 	// Start with defaults.
-	cfg := &CheckConfig{}
-	cfg.Count = defaultCount
-	cfg.Seconds = defaultSeconds
-	cfg.PassingPercent = defaultPassingPercent
-	cfg.RequestType = defaultRequestType
-	cfg.RequestBody = defaultRequestBody
-	cfg.ExpectedStatusCode = defaultExpectedStatusCode
-
-	// Read the check URL.
-	checkURL := os.Getenv("CHECK_URL")
-	if len(checkURL) == 0 {
+	cfg := &CheckConfig{Config: httpcheck.NewConfig()}
+	cfg.LogFormat = defaultLogFormat
+	cfg.LogLevel = log.InfoLevel
+	cfg.HealthMaxAgeSeconds = defaultHealthMaxAgeSeconds
+	cfg.ReportTimeoutSeconds = defaultReportTimeoutSeconds
+
+	// Load the flags and optional config file. Flags override environment
+	// variables, which override the file.
+	source, err := newConfigSource(args)
+	if err != nil {
+		return nil, err
+	}
+	raw := source.values()
+
+	// Read the check URLs, adding any listed in CHECK_URL_FILE.
+	checkURL := raw.CheckURL
+	checkURLFile := raw.CheckURLFile
+	if len(checkURL) == 0 && len(checkURLFile) == 0 {
 		return nil, fmt.Errorf("empty CHECK_URL specified. Please update your CHECK_URL environment variable")
 	}
-	if !strings.HasPrefix(checkURL, "http") {
-		return nil, fmt.Errorf("given URL does not declare a supported protocol. (http | https)")
+	checkURLs, err := parseCheckURLs(checkURL, true)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CHECK_URL: %w", err)
+	}
+	if len(checkURLFile) != 0 {
+		fileURLs, err := readCheckURLFile(checkURLFile)
+		if err != nil {
+			return nil, err
+		}
+		checkURLs = append(checkURLs, fileURLs...)
+	}
+	if len(checkURLs) == 0 {
+		return nil, fmt.Errorf("empty CHECK_URL specified. Please update your CHECK_URL environment variable")
 	}
-	cfg.CheckURL = checkURL
+	cfg.CheckURLs = checkURLs
 
 	// Parse COUNT.
-	count := os.Getenv("COUNT")
+	count := raw.Count
 	if len(count) != 0 {
 		countValue, err := strconv.Atoi(count)
 		if err != nil {
@@ -71,8 +158,13 @@ func parseConfig() (*CheckConfig, error) {
 		cfg.Count = countValue
 	}
 
+	// Require at least one request so the check cannot pass without running.
+	if cfg.Count < 1 {
+		return nil, fmt.Errorf("COUNT must be at least 1, got %d", cfg.Count)
+	}
+
 	// Parse SECONDS.
-	seconds := os.Getenv("SECONDS")
+	seconds := raw.Seconds
 	if len(seconds) != 0 {
 		secondsValue, err := strconv.Atoi(seconds)
 		if err != nil {
@@ -82,7 +174,7 @@ func parseConfig() (*CheckConfig, error) {
 	}
 
 	// Parse PASSING_PERCENT.
-	passing := os.Getenv("PASSING_PERCENT")
+	passing := raw.PassingPercent
 	if len(passing) != 0 {
 		passingValue, err := strconv.Atoi(passing)
 		if err != nil {
@@ -91,33 +183,1548 @@ func parseConfig() (*CheckConfig, error) {
 		cfg.PassingPercent = passingValue
 	}
 	if cfg.PassingPercent == 0 {
-		cfg.PassingPercent = defaultPassingPercent
+		cfg.PassingPercent = httpcheck.DefaultPassingPercent
+	}
+
+	// Parse MAX_FAILURES, which replaces PASSING_PERCENT when set.
+	maxFailures := raw.MaxFailures
+	if len(maxFailures) != 0 {
+		maxFailuresValue, err := strconv.Atoi(maxFailures)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_FAILURES to int: %w", err)
+		}
+		if maxFailuresValue < 0 {
+			return nil, fmt.Errorf("MAX_FAILURES must not be negative, got %d", maxFailuresValue)
+		}
+		cfg.MaxFailures = maxFailuresValue
 	}
 
 	// Parse REQUEST_TYPE.
-	requestType := os.Getenv("REQUEST_TYPE")
+	requestType := raw.RequestType
 	if len(requestType) != 0 {
-		cfg.RequestType = requestType
+		method := strings.ToUpper(requestType)
+		if !slices.Contains(supportedMethods, method) {
+			return nil, fmt.Errorf("unsupported REQUEST_TYPE %q, expected one of %s", requestType, strings.Join(supportedMethods, ", "))
+		}
+		cfg.RequestType = method
 	}
 
-	// Parse REQUEST_BODY.
-	requestBody := os.Getenv("REQUEST_BODY")
+	// Parse REQUEST_BODY, preferring REQUEST_BODY_FILE when both are set. A
+	// body that environment variables were expanded into may hold secrets.
+	requestBody := raw.RequestBody
 	if len(requestBody) != 0 {
-		cfg.RequestBody = requestBody
+		cfg.RequestBody, err = expandEnv("REQUEST_BODY", requestBody)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RedactRequestBody = envReferencePattern.MatchString(requestBody)
+	}
+	requestBodyFile := raw.RequestBodyFile
+	if len(requestBodyFile) != 0 {
+		bodyData, err := os.ReadFile(requestBodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading REQUEST_BODY_FILE: %w", err)
+		}
+		cfg.RequestBody = string(bodyData)
+	}
+
+	// Parse REQUEST_FORM, REQUEST_MULTIPART, and REQUEST_CONTENT_TYPE. Form
+	// fields replace the body and default the content type to form encoding.
+	requestForm := raw.RequestForm
+	requestMultipart := raw.RequestMultipart
+	requestContentType := raw.RequestContentType
+	if len(requestForm) != 0 {
+		if len(requestBody) != 0 || len(requestBodyFile) != 0 {
+			return nil, fmt.Errorf("REQUEST_FORM cannot be combined with REQUEST_BODY or REQUEST_BODY_FILE")
+		}
+		form, err := parseFormFields(requestForm)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing REQUEST_FORM: %w", err)
+		}
+		cfg.RequestBody = form.Encode()
+		cfg.RequestContentType = formContentType
+	}
+	if len(requestMultipart) != 0 {
+		if len(requestBody) != 0 || len(requestBodyFile) != 0 || len(requestForm) != 0 {
+			return nil, fmt.Errorf("REQUEST_MULTIPART cannot be combined with REQUEST_BODY, REQUEST_BODY_FILE, or REQUEST_FORM")
+		}
+		if len(requestContentType) != 0 {
+			return nil, fmt.Errorf("REQUEST_MULTIPART sets its own REQUEST_CONTENT_TYPE with the part boundary")
+		}
+		body, contentType, err := encodeMultipartForm(requestMultipart)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing REQUEST_MULTIPART: %w", err)
+		}
+		cfg.RequestBody = body
+		cfg.RequestContentType = contentType
+	}
+	if len(requestContentType) != 0 {
+		cfg.RequestContentType = requestContentType
+	}
+
+	// Compile an inline REQUEST_BODY as a template when it contains
+	// placeholders. Bodies read from files, forms, and multipart fields are
+	// sent as written since they may legitimately contain {{. The template is
+	// parsed before environment variables are expanded into its text, so
+	// their values are never run as template actions.
+	if len(requestBody) != 0 && len(requestBodyFile) == 0 {
+		bodyTemplate, err := httpcheck.ParseBodyTemplate(requestBody)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing REQUEST_BODY template: %w", err)
+		}
+		err = expandTemplateEnv("REQUEST_BODY", bodyTemplate)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RequestBodyTemplate = bodyTemplate
 	}
 
-	// Parse EXPECTED_STATUS_CODE.
-	expectedStatusCode := os.Getenv("EXPECTED_STATUS_CODE")
+	// Parse EXPECTED_STATUS_CODE as a comma-separated list of codes and ranges.
+	expectedStatusCode := raw.ExpectedStatusCode
 	if len(expectedStatusCode) != 0 {
-		statusValue, err := strconv.Atoi(expectedStatusCode)
+		matcher, err := httpcheck.ParseStatusMatcher(expectedStatusCode)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing EXPECTED_STATUS_CODE: %w", err)
+		}
+		if len(matcher.Ranges) != 0 {
+			cfg.ExpectedStatus = matcher
+		}
+	}
+
+	// Parse REQUEST_TIMEOUT.
+	requestTimeout := raw.RequestTimeout
+	if len(requestTimeout) != 0 {
+		timeoutValue, err := strconv.Atoi(requestTimeout)
 		if err != nil {
-			return nil, fmt.Errorf("error converting EXPECTED_STATUS_CODE to int: %w", err)
+			return nil, fmt.Errorf("error converting REQUEST_TIMEOUT to int: %w", err)
 		}
-		cfg.ExpectedStatusCode = statusValue
+		if timeoutValue < 0 {
+			return nil, fmt.Errorf("REQUEST_TIMEOUT must not be negative, got %d", timeoutValue)
+		}
+		cfg.RequestTimeout = timeoutValue
 	}
-	if cfg.ExpectedStatusCode == 0 {
-		cfg.ExpectedStatusCode = defaultExpectedStatusCode
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = httpcheck.DefaultRequestTimeout
 	}
 
-	return cfg, nil
+	// Parse REQUEST_HEADERS.
+	requestHeaders := raw.RequestHeaders
+	if len(requestHeaders) != 0 {
+		headers, err := parseHeaders(requestHeaders, true)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing REQUEST_HEADERS: %w", err)
+		}
+		cfg.Headers = headers
+	}
+
+	// Parse ROTATE_HEADERS as one header name and the values it cycles
+	// through.
+	rotateHeaders := raw.RotateHeaders
+	if len(rotateHeaders) != 0 {
+		name, values, err := parseRotateHeader(rotateHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ROTATE_HEADERS: %w", err)
+		}
+		if hasHeader(cfg.Headers, name) {
+			return nil, fmt.Errorf("ROTATE_HEADERS header %s is also set in REQUEST_HEADERS", name)
+		}
+		cfg.RotateHeader = name
+		cfg.RotateHeaderValues = values
+	}
+
+	// Parse MIN_COMPRESSION_RATIO.
+	minCompressionRatio := raw.MinCompressionRatio
+	if len(minCompressionRatio) != 0 {
+		ratioValue, err := strconv.ParseFloat(minCompressionRatio, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MIN_COMPRESSION_RATIO to float: %w", err)
+		}
+		if !(ratioValue >= 0) || math.IsInf(ratioValue, 0) {
+			return nil, fmt.Errorf("MIN_COMPRESSION_RATIO must be a finite number of at least 0, got %v", ratioValue)
+		}
+		cfg.MinCompressionRatio = ratioValue
+	}
+
+	// Parse ACCEPT_ENCODING and EXPECTED_CONTENT_ENCODING. Go only reports
+	// Content-Encoding, and leaves the body compressed, when Accept-Encoding
+	// is set explicitly. Unless REQUEST_HEADERS already asks for an encoding,
+	// send ACCEPT_ENCODING, then the expected encoding, then gzip when a
+	// compression ratio is asserted.
+	cfg.ExpectedContentEncoding = raw.ExpectedContentEncoding
+	acceptEncoding := raw.AcceptEncoding
+	if len(acceptEncoding) == 0 {
+		acceptEncoding = cfg.ExpectedContentEncoding
+	}
+	if len(acceptEncoding) == 0 && cfg.MinCompressionRatio > 0 {
+		acceptEncoding = "gzip"
+	}
+	if len(acceptEncoding) != 0 && !hasHeader(cfg.Headers, "Accept-Encoding") {
+		if cfg.Headers == nil {
+			cfg.Headers = make(map[string]string)
+		}
+		cfg.Headers["Accept-Encoding"] = acceptEncoding
+	}
+
+	// Parse EXPECTED_HEADERS.
+	expectedHeaders := raw.ExpectedHeaders
+	if len(expectedHeaders) != 0 {
+		headers, err := parseHeaders(expectedHeaders, false)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing EXPECTED_HEADERS: %w", err)
+		}
+		cfg.ExpectedResponseHeaders = headers
+	}
+
+	// Parse FORBIDDEN_HEADERS, which cannot also be expected.
+	forbiddenHeaders := raw.ForbiddenHeaders
+	if len(forbiddenHeaders) != 0 {
+		names, err := parseHeaderNames(forbiddenHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing FORBIDDEN_HEADERS: %w", err)
+		}
+		for _, name := range names {
+			if hasHeader(cfg.ExpectedResponseHeaders, name) {
+				return nil, fmt.Errorf("header %s cannot be in both EXPECTED_HEADERS and FORBIDDEN_HEADERS", http.CanonicalHeaderKey(name))
+			}
+		}
+		cfg.ForbiddenResponseHeaders = names
+	}
+
+	// Parse EXPECTED_FINAL_URL.
+	cfg.ExpectedFinalURL = raw.ExpectedFinalURL
+
+	// Parse EXPECTED_BODY_EQUALS.
+	cfg.ExpectedBodyEquals = raw.ExpectedBodyEquals
+
+	// Parse EXPECTED_BODY_CONTAINS.
+	cfg.ExpectedBodyContains = raw.ExpectedBodyContains
+
+	// Parse EXPECTED_BODY_REGEX.
+	expectedBodyRegex := raw.ExpectedBodyRegex
+	if len(expectedBodyRegex) != 0 {
+		pattern, err := regexp.Compile(expectedBodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling EXPECTED_BODY_REGEX: %w", err)
+		}
+		cfg.ExpectedBodyRegex = pattern
+	}
+
+	// Parse EXPECTED_JSON_PATH and EXPECTED_JSON_VALUE.
+	cfg.ExpectedJSONPath = raw.ExpectedJSONPath
+	cfg.ExpectedJSONValue = raw.ExpectedJSONValue
+	if len(cfg.ExpectedJSONValue) != 0 && len(cfg.ExpectedJSONPath) == 0 {
+		return nil, fmt.Errorf("EXPECTED_JSON_VALUE is set but EXPECTED_JSON_PATH is empty")
+	}
+
+	// Parse BEARER_TOKEN, preferring BEARER_TOKEN_FILE when both are set.
+	cfg.BearerToken = raw.BearerToken
+	bearerTokenFile := raw.BearerTokenFile
+	if len(bearerTokenFile) != 0 {
+		token, err := os.ReadFile(bearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading BEARER_TOKEN_FILE: %w", err)
+		}
+		cfg.BearerToken = strings.TrimSpace(string(token))
+		if len(cfg.BearerToken) == 0 {
+			return nil, fmt.Errorf("BEARER_TOKEN_FILE %s is empty", bearerTokenFile)
+		}
+	}
+
+	// Parse BASIC_AUTH_USERNAME and BASIC_AUTH_PASSWORD, which must be set together.
+	cfg.BasicAuthUsername = raw.BasicAuthUsername
+	cfg.BasicAuthPassword = raw.BasicAuthPassword
+	if len(cfg.BasicAuthUsername) != 0 && len(cfg.BasicAuthPassword) == 0 {
+		return nil, fmt.Errorf("BASIC_AUTH_USERNAME is set but BASIC_AUTH_PASSWORD is empty")
+	}
+	if len(cfg.BasicAuthPassword) != 0 && len(cfg.BasicAuthUsername) == 0 {
+		return nil, fmt.Errorf("BASIC_AUTH_PASSWORD is set but BASIC_AUTH_USERNAME is empty")
+	}
+
+	// Parse INSECURE_SKIP_VERIFY.
+	insecureSkipVerify := raw.InsecureSkipVerify
+	if len(insecureSkipVerify) != 0 {
+		skipValue, err := strconv.ParseBool(insecureSkipVerify)
+		if err != nil {
+			return nil, fmt.Errorf("error converting INSECURE_SKIP_VERIFY to bool: %w", err)
+		}
+		cfg.InsecureSkipVerify = skipValue
+	}
+
+	// Parse CA_CERT_FILE.
+	caCertFile := raw.CACertFile
+	if len(caCertFile) != 0 {
+		rootCAs, err := loadCertPool(caCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading CA_CERT_FILE: %w", err)
+		}
+		cfg.RootCAs = rootCAs
+	}
+
+	// Parse CLIENT_CERT_FILE and CLIENT_KEY_FILE, which must be set together.
+	clientCertFile := raw.ClientCertFile
+	clientKeyFile := raw.ClientKeyFile
+	if len(clientCertFile) != 0 && len(clientKeyFile) == 0 {
+		return nil, fmt.Errorf("CLIENT_CERT_FILE is set but CLIENT_KEY_FILE is empty")
+	}
+	if len(clientKeyFile) != 0 && len(clientCertFile) == 0 {
+		return nil, fmt.Errorf("CLIENT_KEY_FILE is set but CLIENT_CERT_FILE is empty")
+	}
+	if len(clientCertFile) != 0 {
+		clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		cfg.ClientCertificates = []tls.Certificate{clientCert}
+	}
+
+	// Parse MAX_RESPONSE_TIME_MS.
+	maxResponseTime := raw.MaxResponseTimeMs
+	if len(maxResponseTime) != 0 {
+		maxValue, err := strconv.Atoi(maxResponseTime)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_RESPONSE_TIME_MS to int: %w", err)
+		}
+		if maxValue < 0 {
+			return nil, fmt.Errorf("MAX_RESPONSE_TIME_MS must not be negative, got %d", maxValue)
+		}
+		cfg.MaxResponseTimeMs = maxValue
+	}
+
+	// Parse MAX_DNS_TIME_MS.
+	maxDNSTime := raw.MaxDNSTimeMs
+	if len(maxDNSTime) != 0 {
+		maxValue, err := strconv.Atoi(maxDNSTime)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_DNS_TIME_MS to int: %w", err)
+		}
+		if maxValue < 0 {
+			return nil, fmt.Errorf("MAX_DNS_TIME_MS must not be negative, got %d", maxValue)
+		}
+		cfg.MaxDNSTimeMs = maxValue
+	}
+
+	// Parse RETRIES.
+	retries := raw.Retries
+	if len(retries) != 0 {
+		retriesValue, err := strconv.Atoi(retries)
+		if err != nil {
+			return nil, fmt.Errorf("error converting RETRIES to int: %w", err)
+		}
+		if retriesValue < 0 {
+			return nil, fmt.Errorf("RETRIES must not be negative, got %d", retriesValue)
+		}
+		cfg.Retries = retriesValue
+	}
+
+	// Parse RETRY_BACKOFF_MS.
+	retryBackoff := raw.RetryBackoffMs
+	if len(retryBackoff) != 0 {
+		backoffValue, err := strconv.Atoi(retryBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("error converting RETRY_BACKOFF_MS to int: %w", err)
+		}
+		if backoffValue < 0 {
+			return nil, fmt.Errorf("RETRY_BACKOFF_MS must not be negative, got %d", backoffValue)
+		}
+		cfg.RetryBackoffMs = backoffValue
+	}
+
+	// Parse MAX_RETRY_AFTER_SECONDS.
+	maxRetryAfter := raw.MaxRetryAfterSeconds
+	if len(maxRetryAfter) != 0 {
+		maxRetryAfterValue, err := strconv.Atoi(maxRetryAfter)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_RETRY_AFTER_SECONDS to int: %w", err)
+		}
+		if maxRetryAfterValue < 0 {
+			return nil, fmt.Errorf("MAX_RETRY_AFTER_SECONDS must not be negative, got %d", maxRetryAfterValue)
+		}
+		cfg.MaxRetryAfterSeconds = maxRetryAfterValue
+	}
+
+	// Parse RETRY_ON_STATUS with the same syntax as EXPECTED_STATUS_CODE.
+	retryOnStatus := raw.RetryOnStatus
+	if len(retryOnStatus) != 0 {
+		matcher, err := httpcheck.ParseStatusMatcher(retryOnStatus)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing RETRY_ON_STATUS: %w", err)
+		}
+		if len(matcher.Ranges) != 0 {
+			if cfg.Retries == 0 {
+				return nil, fmt.Errorf("RETRY_ON_STATUS requires RETRIES to be greater than zero")
+			}
+			cfg.RetryOnStatus = matcher
+		}
+	}
+
+	// Parse FOLLOW_REDIRECTS.
+	followRedirects := raw.FollowRedirects
+	if len(followRedirects) != 0 {
+		followValue, err := strconv.ParseBool(followRedirects)
+		if err != nil {
+			return nil, fmt.Errorf("error converting FOLLOW_REDIRECTS to bool: %w", err)
+		}
+		cfg.FollowRedirects = followValue
+	}
+
+	// Parse MAX_REDIRECTS.
+	maxRedirects := raw.MaxRedirects
+	if len(maxRedirects) != 0 {
+		redirectsValue, err := strconv.Atoi(maxRedirects)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_REDIRECTS to int: %w", err)
+		}
+		if redirectsValue < 0 {
+			return nil, fmt.Errorf("MAX_REDIRECTS must not be negative, got %d", redirectsValue)
+		}
+		cfg.MaxRedirects = redirectsValue
+	}
+
+	// Parse METRICS_PORT.
+	metricsPort := raw.MetricsPort
+	if len(metricsPort) != 0 {
+		portValue, err := strconv.Atoi(metricsPort)
+		if err != nil {
+			return nil, fmt.Errorf("error converting METRICS_PORT to int: %w", err)
+		}
+		if portValue < 1 || portValue > 65535 {
+			return nil, fmt.Errorf("METRICS_PORT must be between 1 and 65535, got %d", portValue)
+		}
+		cfg.MetricsPort = portValue
+	}
+
+	// Parse CONCURRENCY.
+	concurrency := raw.Concurrency
+	if len(concurrency) != 0 {
+		concurrencyValue, err := strconv.Atoi(concurrency)
+		if err != nil {
+			return nil, fmt.Errorf("error converting CONCURRENCY to int: %w", err)
+		}
+		if concurrencyValue < 1 {
+			return nil, fmt.Errorf("CONCURRENCY must be at least 1, got %d", concurrencyValue)
+		}
+		cfg.Concurrency = concurrencyValue
+	}
+
+	// Parse REQUIRE_HTTP2.
+	requireHTTP2 := raw.RequireHTTP2
+	if len(requireHTTP2) != 0 {
+		requireValue, err := strconv.ParseBool(requireHTTP2)
+		if err != nil {
+			return nil, fmt.Errorf("error converting REQUIRE_HTTP2 to bool: %w", err)
+		}
+		cfg.RequireHTTP2 = requireValue
+	}
+
+	// Parse PROXY_URL.
+	proxyURL := raw.ProxyURL
+	if len(proxyURL) != 0 {
+		parsedProxy, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing PROXY_URL: %w", urlParseError(err))
+		}
+		if parsedProxy.Scheme != "http" && parsedProxy.Scheme != "https" && parsedProxy.Scheme != "socks5" {
+			return nil, fmt.Errorf("PROXY_URL must use http, https, or socks5, got %q", parsedProxy.Scheme)
+		}
+		if len(parsedProxy.Host) == 0 {
+			return nil, fmt.Errorf("PROXY_URL %s has no host", httpcheck.RedactURL(parsedProxy, nil))
+		}
+		cfg.ProxyURL = parsedProxy
+	}
+
+	// Parse CHECK_DEADLINE_SECONDS.
+	checkDeadline := raw.CheckDeadlineSeconds
+	if len(checkDeadline) != 0 {
+		deadlineValue, err := strconv.Atoi(checkDeadline)
+		if err != nil {
+			return nil, fmt.Errorf("error converting CHECK_DEADLINE_SECONDS to int: %w", err)
+		}
+		if deadlineValue < 0 {
+			return nil, fmt.Errorf("CHECK_DEADLINE_SECONDS must not be negative, got %d", deadlineValue)
+		}
+		cfg.CheckDeadlineSeconds = deadlineValue
+	}
+
+	// Parse WARMUP_REQUESTS.
+	warmupRequests := raw.WarmupRequests
+	if len(warmupRequests) != 0 {
+		warmupValue, err := strconv.Atoi(warmupRequests)
+		if err != nil {
+			return nil, fmt.Errorf("error converting WARMUP_REQUESTS to int: %w", err)
+		}
+		if warmupValue < 0 {
+			return nil, fmt.Errorf("WARMUP_REQUESTS must not be negative, got %d", warmupValue)
+		}
+		cfg.WarmupRequests = warmupValue
+	}
+
+	// Parse LOGIN_URL, LOGIN_REQUEST_TYPE, and LOGIN_REQUEST_BODY.
+	loginURL := raw.LoginURL
+	loginRequestType := raw.LoginRequestType
+	cfg.LoginRequestBody = raw.LoginRequestBody
+	if len(loginURL) != 0 {
+		loginURLs, err := parseCheckURLs(loginURL, false)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing LOGIN_URL: %w", err)
+		}
+		if len(loginURLs) != 1 {
+			return nil, fmt.Errorf("LOGIN_URL must be a single URL, got %d", len(loginURLs))
+		}
+		cfg.LoginURL = loginURLs[0]
+	}
+	if len(loginRequestType) != 0 {
+		method := strings.ToUpper(loginRequestType)
+		if !slices.Contains(supportedMethods, method) {
+			return nil, fmt.Errorf("unsupported LOGIN_REQUEST_TYPE %q, expected one of %s", loginRequestType, strings.Join(supportedMethods, ", "))
+		}
+		cfg.LoginRequestType = method
+	}
+
+	// Parse REQUEST_COOKIES.
+	requestCookies := raw.RequestCookies
+	if len(requestCookies) != 0 {
+		cookies, err := http.ParseCookie(requestCookies)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing REQUEST_COOKIES: %w", err)
+		}
+		cfg.RequestCookies = cookies
+	}
+
+	// Parse LOG_FORMAT.
+	logFormat := raw.LogFormat
+	if len(logFormat) != 0 {
+		format := strings.ToLower(logFormat)
+		if !slices.Contains(supportedLogFormats, format) {
+			return nil, fmt.Errorf("unsupported LOG_FORMAT %q, expected one of %s", logFormat, strings.Join(supportedLogFormats, ", "))
+		}
+		cfg.LogFormat = format
+	}
+
+	// Parse LOG_LEVEL.
+	logLevel := raw.LogLevel
+	if len(logLevel) != 0 {
+		level, err := log.ParseLevel(logLevel)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing LOG_LEVEL: %w", err)
+		}
+		cfg.LogLevel = level
+	}
+
+	// Parse DRY_RUN.
+	dryRun := raw.DryRun
+	if len(dryRun) != 0 {
+		dryRunValue, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("error converting DRY_RUN to bool: %w", err)
+		}
+		cfg.DryRun = dryRunValue
+	}
+
+	// Parse REDACT_QUERY_PARAMS.
+	redactQueryParams := raw.RedactQueryParams
+	if len(redactQueryParams) != 0 {
+		params := []string{}
+		for _, param := range strings.Split(redactQueryParams, ",") {
+			param = strings.TrimSpace(param)
+			if len(param) != 0 {
+				params = append(params, param)
+			}
+		}
+		cfg.RedactQueryParams = params
+	}
+
+	// Parse MIN_TLS_VERSION and ASSERT_MIN_TLS_VERSION.
+	minTLSVersion := raw.MinTLSVersion
+	if len(minTLSVersion) != 0 {
+		version, ok := tlsVersions[minTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported MIN_TLS_VERSION %q, expected 1.2 or 1.3", minTLSVersion)
+		}
+		cfg.MinTLSVersion = version
+	}
+	assertMinTLSVersion := raw.AssertMinTLSVersion
+	if len(assertMinTLSVersion) != 0 {
+		assertValue, err := strconv.ParseBool(assertMinTLSVersion)
+		if err != nil {
+			return nil, fmt.Errorf("error converting ASSERT_MIN_TLS_VERSION to bool: %w", err)
+		}
+		cfg.AssertMinTLSVersion = assertValue
+	}
+	if cfg.AssertMinTLSVersion && cfg.MinTLSVersion == 0 {
+		return nil, fmt.Errorf("ASSERT_MIN_TLS_VERSION requires MIN_TLS_VERSION")
+	}
+
+	// Parse CERT_EXPIRY_WARNING_DAYS and CERT_EXPIRY_FAIL.
+	certExpiryWarningDays := raw.CertExpiryWarningDays
+	if len(certExpiryWarningDays) != 0 {
+		daysValue, err := strconv.Atoi(certExpiryWarningDays)
+		if err != nil {
+			return nil, fmt.Errorf("error converting CERT_EXPIRY_WARNING_DAYS to int: %w", err)
+		}
+		if daysValue < 0 {
+			return nil, fmt.Errorf("CERT_EXPIRY_WARNING_DAYS must not be negative, got %d", daysValue)
+		}
+		cfg.CertExpiryWarningDays = daysValue
+	}
+	certExpiryFail := raw.CertExpiryFail
+	if len(certExpiryFail) != 0 {
+		failValue, err := strconv.ParseBool(certExpiryFail)
+		if err != nil {
+			return nil, fmt.Errorf("error converting CERT_EXPIRY_FAIL to bool: %w", err)
+		}
+		cfg.CertExpiryFail = failValue
+	}
+
+	// Parse HOST_OVERRIDE.
+	hostOverride := raw.HostOverride
+	if len(hostOverride) != 0 {
+		if strings.ContainsAny(hostOverride, "/ ") {
+			return nil, fmt.Errorf("HOST_OVERRIDE must be a host name with an optional port, got %q", hostOverride)
+		}
+		cfg.HostOverride = hostOverride
+	}
+
+	// Parse STATUS_WEIGHTS.
+	statusWeights := raw.StatusWeights
+	if len(statusWeights) != 0 {
+		weights, err := httpcheck.ParseStatusWeights(statusWeights)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing STATUS_WEIGHTS: %w", err)
+		}
+		cfg.StatusWeights = weights
+	}
+
+	// Parse DISABLE_KEEPALIVE and MAX_IDLE_CONNS.
+	disableKeepAlive := raw.DisableKeepAlive
+	if len(disableKeepAlive) != 0 {
+		disableValue, err := strconv.ParseBool(disableKeepAlive)
+		if err != nil {
+			return nil, fmt.Errorf("error converting DISABLE_KEEPALIVE to bool: %w", err)
+		}
+		cfg.DisableKeepAlives = disableValue
+	}
+	maxIdleConns := raw.MaxIdleConns
+	if len(maxIdleConns) != 0 {
+		idleValue, err := strconv.Atoi(maxIdleConns)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_IDLE_CONNS to int: %w", err)
+		}
+		if idleValue < 0 {
+			return nil, fmt.Errorf("MAX_IDLE_CONNS must not be negative, got %d", idleValue)
+		}
+		cfg.MaxIdleConns = idleValue
+	}
+	if cfg.DisableKeepAlives && cfg.MaxIdleConns > 0 {
+		return nil, fmt.Errorf("MAX_IDLE_CONNS has no effect when DISABLE_KEEPALIVE is true")
+	}
+
+	// Parse SECONDS_BACKOFF_FACTOR and SECONDS_MAX.
+	secondsBackoffFactor := raw.SecondsBackoffFactor
+	if len(secondsBackoffFactor) != 0 {
+		factorValue, err := strconv.ParseFloat(secondsBackoffFactor, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error converting SECONDS_BACKOFF_FACTOR to float: %w", err)
+		}
+		if !(factorValue >= 1) {
+			return nil, fmt.Errorf("SECONDS_BACKOFF_FACTOR must be at least 1, got %v", factorValue)
+		}
+		cfg.SecondsBackoffFactor = factorValue
+	}
+	secondsMax := raw.SecondsMax
+	if len(secondsMax) != 0 {
+		maxValue, err := strconv.Atoi(secondsMax)
+		if err != nil {
+			return nil, fmt.Errorf("error converting SECONDS_MAX to int: %w", err)
+		}
+		if maxValue < 0 {
+			return nil, fmt.Errorf("SECONDS_MAX must not be negative, got %d", maxValue)
+		}
+		cfg.SecondsMax = maxValue
+	}
+
+	// Parse INITIAL_DELAY_SECONDS.
+	initialDelay := raw.InitialDelaySeconds
+	if len(initialDelay) != 0 {
+		delayValue, err := strconv.Atoi(initialDelay)
+		if err != nil {
+			return nil, fmt.Errorf("error converting INITIAL_DELAY_SECONDS to int: %w", err)
+		}
+		if delayValue < 0 {
+			return nil, fmt.Errorf("INITIAL_DELAY_SECONDS must not be negative, got %d", delayValue)
+		}
+		cfg.InitialDelaySeconds = delayValue
+	}
+
+	// Parse CACHE_BUST.
+	cacheBust := raw.CacheBust
+	if len(cacheBust) != 0 {
+		cacheBustValue, err := strconv.ParseBool(cacheBust)
+		if err != nil {
+			return nil, fmt.Errorf("error converting CACHE_BUST to bool: %w", err)
+		}
+		cfg.CacheBust = cacheBustValue
+	}
+
+	// Parse MAX_BODY_BYTES.
+	maxBodyBytes := raw.MaxBodyBytes
+	if len(maxBodyBytes) != 0 {
+		maxBodyValue, err := strconv.Atoi(maxBodyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_BODY_BYTES to int: %w", err)
+		}
+		if maxBodyValue < 1 {
+			return nil, fmt.Errorf("MAX_BODY_BYTES must be at least 1, got %d", maxBodyValue)
+		}
+		cfg.MaxBodyBytes = maxBodyValue
+	}
+
+	// Parse FAIL_ON_LARGE_BODY.
+	failOnLargeBody := raw.FailOnLargeBody
+	if len(failOnLargeBody) != 0 {
+		failValue, err := strconv.ParseBool(failOnLargeBody)
+		if err != nil {
+			return nil, fmt.Errorf("error converting FAIL_ON_LARGE_BODY to bool: %w", err)
+		}
+		cfg.FailOnLargeBody = failValue
+	}
+
+	// Parse IP_VERSION.
+	ipVersion := raw.IPVersion
+	if len(ipVersion) != 0 {
+		version, ok := ipVersions[strings.ToLower(ipVersion)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported IP_VERSION %q, expected 4, 6, or auto", ipVersion)
+		}
+		cfg.IPVersion = version
+	}
+
+	// Parse NOTIFY_WEBHOOK_URL. The URL is left out of errors because webhook
+	// URLs often embed a token.
+	notifyWebhookURL := raw.NotifyWebhookURL
+	if len(notifyWebhookURL) != 0 {
+		parsedWebhook, err := url.Parse(notifyWebhookURL)
+		if err != nil {
+			return nil, errors.New("error parsing NOTIFY_WEBHOOK_URL: invalid URL")
+		}
+		if parsedWebhook.Scheme != "http" && parsedWebhook.Scheme != "https" {
+			return nil, fmt.Errorf("NOTIFY_WEBHOOK_URL must use http or https, got %q", parsedWebhook.Scheme)
+		}
+		if len(parsedWebhook.Host) == 0 {
+			return nil, errors.New("NOTIFY_WEBHOOK_URL has no host")
+		}
+		cfg.NotifyWebhookURL = parsedWebhook
+	}
+
+	// Parse SUMMARY_JSON.
+	summaryJSON := raw.SummaryJSON
+	if len(summaryJSON) != 0 {
+		summaryJSONValue, err := strconv.ParseBool(summaryJSON)
+		if err != nil {
+			return nil, fmt.Errorf("error converting SUMMARY_JSON to bool: %w", err)
+		}
+		cfg.SummaryJSON = summaryJSONValue
+	}
+
+	// Parse USER_AGENT.
+	userAgent := raw.UserAgent
+	if len(userAgent) != 0 {
+		cfg.UserAgent = userAgent
+	}
+
+	// Parse EARLY_EXIT.
+	earlyExit := raw.EarlyExit
+	if len(earlyExit) != 0 {
+		earlyExitValue, err := strconv.ParseBool(earlyExit)
+		if err != nil {
+			return nil, fmt.Errorf("error converting EARLY_EXIT to bool: %w", err)
+		}
+		cfg.EarlyExit = earlyExitValue
+	}
+
+	// Parse REQUEST_IF_NONE_MATCH.
+	cfg.IfNoneMatch = raw.RequestIfNoneMatch
+
+	// Parse JITTER_PERCENT.
+	jitterPercent := raw.JitterPercent
+	if len(jitterPercent) != 0 {
+		jitterValue, err := strconv.Atoi(jitterPercent)
+		if err != nil {
+			return nil, fmt.Errorf("error converting JITTER_PERCENT to int: %w", err)
+		}
+		if jitterValue < 0 || jitterValue > 100 {
+			return nil, fmt.Errorf("JITTER_PERCENT must be between 0 and 100, got %d", jitterValue)
+		}
+		cfg.JitterPercent = jitterValue
+	}
+
+	// Parse RANDOM_SEED.
+	randomSeed := raw.RandomSeed
+	if len(randomSeed) != 0 {
+		seedValue, err := strconv.ParseInt(randomSeed, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error converting RANDOM_SEED to int: %w", err)
+		}
+		cfg.RandomSeed = seedValue
+	}
+
+	// Parse EXPECTED_JSON_SCHEMA_FILE.
+	expectedJSONSchemaFile := raw.ExpectedJSONSchemaFile
+	if len(expectedJSONSchemaFile) != 0 {
+		schemaData, err := os.ReadFile(expectedJSONSchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading EXPECTED_JSON_SCHEMA_FILE: %w", err)
+		}
+		schema, err := httpcheck.ParseJSONSchema(schemaData)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing EXPECTED_JSON_SCHEMA_FILE: %w", err)
+		}
+		cfg.ExpectedJSONSchema = schema
+	}
+
+	// Parse MAX_TTFB_MS.
+	maxTTFB := raw.MaxTTFBMs
+	if len(maxTTFB) != 0 {
+		maxValue, err := strconv.Atoi(maxTTFB)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_TTFB_MS to int: %w", err)
+		}
+		if maxValue < 0 {
+			return nil, fmt.Errorf("MAX_TTFB_MS must not be negative, got %d", maxValue)
+		}
+		cfg.MaxTTFBMs = maxValue
+	}
+
+	// Parse HEALTH_PORT and HEALTH_MAX_AGE_SECONDS.
+	healthPort := raw.HealthPort
+	if len(healthPort) != 0 {
+		portValue, err := strconv.Atoi(healthPort)
+		if err != nil {
+			return nil, fmt.Errorf("error converting HEALTH_PORT to int: %w", err)
+		}
+		if portValue < 1 || portValue > 65535 {
+			return nil, fmt.Errorf("HEALTH_PORT must be between 1 and 65535, got %d", portValue)
+		}
+		if portValue == cfg.MetricsPort {
+			return nil, fmt.Errorf("HEALTH_PORT must differ from METRICS_PORT, both are %d", portValue)
+		}
+		cfg.HealthPort = portValue
+	}
+	healthMaxAge := raw.HealthMaxAgeSeconds
+	if len(healthMaxAge) != 0 {
+		maxAgeValue, err := strconv.Atoi(healthMaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("error converting HEALTH_MAX_AGE_SECONDS to int: %w", err)
+		}
+		if maxAgeValue < 1 {
+			return nil, fmt.Errorf("HEALTH_MAX_AGE_SECONDS must be at least 1, got %d", maxAgeValue)
+		}
+		cfg.HealthMaxAgeSeconds = maxAgeValue
+	}
+
+	// Parse REPORT_TIMEOUT_SECONDS.
+	reportTimeout := raw.ReportTimeoutSeconds
+	if len(reportTimeout) != 0 {
+		reportTimeoutValue, err := strconv.Atoi(reportTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("error converting REPORT_TIMEOUT_SECONDS to int: %w", err)
+		}
+		if reportTimeoutValue < 0 {
+			return nil, fmt.Errorf("REPORT_TIMEOUT_SECONDS must not be negative, got %d", reportTimeoutValue)
+		}
+		cfg.ReportTimeoutSeconds = reportTimeoutValue
+	}
+
+	// Parse EXIT_CODE_ON_FAILURE.
+	cfg.ExitCodeOnFailure, err = parseExitCode(raw.ExitCodeOnFailure)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse REQUIRE_KH_ENDPOINT.
+	requireKHEndpoint := raw.RequireKHEndpoint
+	if len(requireKHEndpoint) != 0 {
+		requireValue, err := strconv.ParseBool(requireKHEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("error converting REQUIRE_KH_ENDPOINT to bool: %w", err)
+		}
+		cfg.RequireKHEndpoint = requireValue
+	}
+
+	// Parse FAIL_FAST_ON_DNS.
+	failFastOnDNS := raw.FailFastOnDNS
+	if len(failFastOnDNS) != 0 {
+		failFastValue, err := strconv.ParseBool(failFastOnDNS)
+		if err != nil {
+			return nil, fmt.Errorf("error converting FAIL_FAST_ON_DNS to bool: %w", err)
+		}
+		cfg.FailFastOnDNS = failFastValue
+	}
+
+	// Parse PROTOCOL, GRPC_SERVICE, and WEBSOCKET_PING.
+	protocol := strings.ToLower(strings.TrimSpace(raw.Protocol))
+	if len(protocol) != 0 {
+		if protocol != httpcheck.ProtocolHTTP && protocol != httpcheck.ProtocolGRPC && protocol != httpcheck.ProtocolWebSocket {
+			return nil, fmt.Errorf("PROTOCOL must be http, grpc, or websocket, got %q", protocol)
+		}
+		cfg.Protocol = protocol
+	}
+	cfg.GRPCService = raw.GRPCService
+	if len(cfg.GRPCService) != 0 && cfg.Protocol != httpcheck.ProtocolGRPC {
+		return nil, fmt.Errorf("GRPC_SERVICE requires PROTOCOL to be grpc")
+	}
+	webSocketPing := raw.WebSocketPing
+	if len(webSocketPing) != 0 {
+		pingValue, err := strconv.ParseBool(webSocketPing)
+		if err != nil {
+			return nil, fmt.Errorf("error converting WEBSOCKET_PING to bool: %w", err)
+		}
+		if pingValue && cfg.Protocol != httpcheck.ProtocolWebSocket {
+			return nil, fmt.Errorf("WEBSOCKET_PING requires PROTOCOL to be websocket")
+		}
+		cfg.WebSocketPing = pingValue
+	}
+
+	// Parse MAX_P95_MS and MAX_P99_MS.
+	maxP95 := raw.MaxP95Ms
+	if len(maxP95) != 0 {
+		maxP95Value, err := strconv.Atoi(maxP95)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_P95_MS to int: %w", err)
+		}
+		if maxP95Value < 0 {
+			return nil, fmt.Errorf("MAX_P95_MS must not be negative, got %d", maxP95Value)
+		}
+		cfg.MaxP95Ms = maxP95Value
+	}
+	maxP99 := raw.MaxP99Ms
+	if len(maxP99) != 0 {
+		maxP99Value, err := strconv.Atoi(maxP99)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_P99_MS to int: %w", err)
+		}
+		if maxP99Value < 0 {
+			return nil, fmt.Errorf("MAX_P99_MS must not be negative, got %d", maxP99Value)
+		}
+		cfg.MaxP99Ms = maxP99Value
+	}
+
+	// Parse DIAL_TIMEOUT_MS.
+	dialTimeout := raw.DialTimeoutMs
+	if len(dialTimeout) != 0 {
+		dialTimeoutValue, err := strconv.Atoi(dialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("error converting DIAL_TIMEOUT_MS to int: %w", err)
+		}
+		if dialTimeoutValue < 0 {
+			return nil, fmt.Errorf("DIAL_TIMEOUT_MS must not be negative, got %d", dialTimeoutValue)
+		}
+		cfg.DialTimeoutMs = dialTimeoutValue
+	}
+
+	// Parse SUCCESS_JSON_PATH.
+	cfg.SuccessJSONPath = raw.SuccessJSONPath
+
+	// Parse HOST_ALIASES.
+	hostAliases := raw.HostAliases
+	if len(hostAliases) != 0 {
+		aliases, err := parseHostAliases(hostAliases)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing HOST_ALIASES: %w", err)
+		}
+		cfg.HostAliases = aliases
+	}
+
+	// Parse TRAILING_WINDOW.
+	trailingWindow := raw.TrailingWindow
+	if len(trailingWindow) != 0 {
+		trailingWindowValue, err := strconv.Atoi(trailingWindow)
+		if err != nil {
+			return nil, fmt.Errorf("error converting TRAILING_WINDOW to int: %w", err)
+		}
+		if trailingWindowValue < 0 {
+			return nil, fmt.Errorf("TRAILING_WINDOW must not be negative, got %d", trailingWindowValue)
+		}
+		cfg.TrailingWindow = trailingWindowValue
+	}
+
+	// Parse EXPECTED_STREAM_LINE, which replaces reading the whole body.
+	cfg.ExpectedStreamLine = raw.ExpectedStreamLine
+	if len(cfg.ExpectedStreamLine) != 0 {
+		if cfg.Protocol != httpcheck.ProtocolHTTP || cfg.RequestType == http.MethodHead {
+			return nil, fmt.Errorf("EXPECTED_STREAM_LINE requires PROTOCOL http and a REQUEST_TYPE other than HEAD")
+		}
+		if cfg.ExpectedJSONSchema != nil || len(cfg.ExpectedBodyEquals) != 0 || len(cfg.ExpectedBodyContains) != 0 || cfg.ExpectedBodyRegex != nil || len(cfg.ExpectedJSONPath) != 0 {
+			return nil, fmt.Errorf("EXPECTED_STREAM_LINE cannot be combined with the EXPECTED_BODY_* or EXPECTED_JSON_* assertions, which read the whole body")
+		}
+	}
+
+	// Parse MAX_RESPONSE_HEADER_BYTES.
+	maxHeaderBytes := raw.MaxResponseHeaderBytes
+	if len(maxHeaderBytes) != 0 {
+		maxHeaderBytesValue, err := strconv.ParseInt(maxHeaderBytes, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error converting MAX_RESPONSE_HEADER_BYTES to int: %w", err)
+		}
+		if maxHeaderBytesValue < 0 {
+			return nil, fmt.Errorf("MAX_RESPONSE_HEADER_BYTES must not be negative, got %d", maxHeaderBytesValue)
+		}
+		cfg.MaxResponseHeaderBytes = maxHeaderBytesValue
+	}
+
+	// Parse IDEMPOTENCY_CHECK.
+	idempotencyCheck := strings.ToLower(strings.TrimSpace(raw.IdempotencyCheck))
+	if len(idempotencyCheck) != 0 {
+		if idempotencyCheck != httpcheck.IdempotencyStatus && idempotencyCheck != httpcheck.IdempotencyBody {
+			return nil, fmt.Errorf("IDEMPOTENCY_CHECK must be status or body, got %q", idempotencyCheck)
+		}
+		if cfg.Protocol != httpcheck.ProtocolHTTP {
+			return nil, fmt.Errorf("IDEMPOTENCY_CHECK requires PROTOCOL http")
+		}
+		if idempotencyCheck == httpcheck.IdempotencyBody && len(cfg.ExpectedStreamLine) != 0 {
+			return nil, fmt.Errorf("IDEMPOTENCY_CHECK body cannot be combined with EXPECTED_STREAM_LINE, which stops reading the body early")
+		}
+		cfg.IdempotencyCheck = idempotencyCheck
+	}
+
+	// Parse PASS_ON_ANY_SUCCESS.
+	passOnAnySuccess := raw.PassOnAnySuccess
+	if len(passOnAnySuccess) != 0 {
+		passOnAnyValue, err := strconv.ParseBool(passOnAnySuccess)
+		if err != nil {
+			return nil, fmt.Errorf("error converting PASS_ON_ANY_SUCCESS to bool: %w", err)
+		}
+		cfg.PassOnAnySuccess = passOnAnyValue
+	}
+
+	// Parse ALLOW_EMPTY_BODY.
+	allowEmptyBody := raw.AllowEmptyBody
+	if len(allowEmptyBody) != 0 {
+		cfg.AllowEmptyBody, err = strconv.ParseBool(allowEmptyBody)
+		if err != nil {
+			return nil, fmt.Errorf("error converting ALLOW_EMPTY_BODY to bool: %w", err)
+		}
+	}
+
+	// Apply the same validation as the library, naming the settings that fix
+	// a missing body.
+	err = cfg.Validate()
+	if errors.Is(err, httpcheck.ErrMissingRequestBody) {
+		return nil, fmt.Errorf("REQUEST_TYPE %s needs REQUEST_BODY, REQUEST_BODY_FILE, REQUEST_FORM, or REQUEST_MULTIPART, or ALLOW_EMPTY_BODY=true to send an empty body", cfg.RequestType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	// Reject config file keys that no setting recognized.
+	unknownKeys := source.unknownKeys()
+	if len(unknownKeys) != 0 {
+		return nil, fmt.Errorf("unknown keys in CONFIG_FILE: %s", strings.Join(unknownKeys, ", "))
+	}
+
+	return cfg, nil
+}
+
+// parseCheckURLs parses and validates a comma- or newline-separated list of
+// URLs. A list with only separators yields no URLs and no error. With expand
+// set, ${NAME} references are expanded in each URL after the list is split,
+// so a variable cannot add URLs.
+func parseCheckURLs(raw string, expand bool) ([]*url.URL, error) {
+	// Split on both separators.
+	entries := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+
+	// Errors name the entry by position because the URL may carry secrets.
+	checkURLs := []*url.URL{}
+	for index, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		if expand {
+			var err error
+			entry, err = expandEnvLine(fmt.Sprintf("URL %d", index+1), entry)
+			if err != nil {
+				return nil, err
+			}
+		}
+		parsedURL, err := url.Parse(entry)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse provided URL %d: %w", index+1, urlParseError(err))
+		}
+		err = validateCheckURL(parsedURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL %d: %w", index+1, err)
+		}
+		checkURLs = append(checkURLs, parsedURL)
+	}
+
+	return checkURLs, nil
+}
+
+// readCheckURLFile reads the URLs listed in a CHECK_URL_FILE, one per line.
+// Blank lines are skipped, and a # at the start of a line or after whitespace
+// starts a comment.
+func readCheckURLFile(path string) ([]*url.URL, error) {
+	// Read the file.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CHECK_URL_FILE: %w", err)
+	}
+
+	// Errors name the entry by line because the URL may carry secrets.
+	checkURLs := []*url.URL{}
+	for index, line := range strings.Split(string(data), "\n") {
+		entry := stripURLComment(line)
+		if len(entry) == 0 {
+			continue
+		}
+		parsedURL, err := url.Parse(entry)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing CHECK_URL_FILE: cannot parse the URL on line %d: %w", index+1, urlParseError(err))
+		}
+		err = validateCheckURL(parsedURL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing CHECK_URL_FILE: invalid URL on line %d: %w", index+1, err)
+		}
+		checkURLs = append(checkURLs, parsedURL)
+	}
+
+	return checkURLs, nil
+}
+
+// stripURLComment trims a CHECK_URL_FILE line and drops its comment. A # with
+// no whitespace before it is kept so URL fragments survive.
+func stripURLComment(line string) string {
+	// Cut at the first # that starts the line or follows whitespace.
+	line = strings.TrimSpace(line)
+	for index, r := range line {
+		if r != '#' {
+			continue
+		}
+		if index == 0 || line[index-1] == ' ' || line[index-1] == '\t' {
+			return strings.TrimSpace(line[:index])
+		}
+	}
+
+	return line
+}
+
+// validateCheckURL requires an absolute http or https URL with a host.
+func validateCheckURL(parsedURL *url.URL) error {
+	// Require a scheme so bare hosts are not read as paths.
+	if !parsedURL.IsAbs() {
+		return fmt.Errorf("not absolute, expected it to start with http:// or https://")
+	}
+
+	// Accept only the exact http and https schemes.
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q, expected http or https", parsedURL.Scheme)
+	}
+
+	// Require a host to connect to.
+	if len(parsedURL.Hostname()) == 0 {
+		return fmt.Errorf("missing host")
+	}
+
+	return nil
+}
+
+// urlParseError strips the raw URL from a url.Parse error, since it may carry
+// credentials or secret query parameters.
+func urlParseError(err error) error {
+	// Keep only the underlying cause.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
+
+// loadCertPool builds a certificate pool from the system roots plus the PEM
+// certificates in path.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	// Read the PEM bundle.
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start from the system roots so public endpoints keep working.
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("no valid PEM certificates found in %s", path)
+	}
+
+	return pool, nil
+}
+
+// parseFormFields parses "key: value" form fields separated by newlines, or
+// by commas when the input is a single line.
+func parseFormFields(raw string) (url.Values, error) {
+	// Split entries on newlines, falling back to commas.
+	separator := "\n"
+	if !strings.Contains(raw, "\n") {
+		separator = ","
+	}
+
+	form := url.Values{}
+	for index, entry := range strings.Split(raw, separator) {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		// Each entry must be a non-empty key followed by a colon.
+		key, value, found := strings.Cut(entry, ":")
+		key = strings.TrimSpace(key)
+		if !found || len(key) == 0 {
+			return nil, fmt.Errorf("malformed form field %d, expected \"key: value\"", index+1)
+		}
+		form.Add(key, strings.TrimSpace(value))
+	}
+
+	return form, nil
+}
+
+// encodeMultipartForm encodes "key: value" fields, in the REQUEST_FORM syntax,
+// as a multipart/form-data body and returns it with its content type. A value
+// of "@path" attaches the named file, and a leading "@@" sends a literal "@".
+func encodeMultipartForm(raw string) (string, string, error) {
+	// Parse the fields and write them in key order.
+	form, err := parseFormFields(raw)
+	if err != nil {
+		return "", "", err
+	}
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, key := range keys {
+		for _, value := range form[key] {
+			// Send plain values as text fields.
+			if !strings.HasPrefix(value, "@") || strings.HasPrefix(value, "@@") {
+				err = writer.WriteField(key, strings.TrimPrefix(value, "@"))
+				if err != nil {
+					return "", "", err
+				}
+				continue
+			}
+
+			// Attach the file under its base name.
+			path := value[1:]
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", "", fmt.Errorf("error reading the file for field %s: %w", key, err)
+			}
+			part, err := writer.CreateFormFile(key, filepath.Base(path))
+			if err != nil {
+				return "", "", err
+			}
+			_, err = part.Write(data)
+			if err != nil {
+				return "", "", err
+			}
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return "", "", err
+	}
+
+	return body.String(), writer.FormDataContentType(), nil
+}
+
+// parseRotateHeader parses "Name: value1,value2" into the header name and its
+// values.
+func parseRotateHeader(raw string) (string, []string, error) {
+	// Split the name from the values.
+	name, list, found := strings.Cut(raw, ":")
+	name = strings.TrimSpace(name)
+	if !found || len(name) == 0 {
+		return "", nil, fmt.Errorf("expected \"Name: value1,value2\"")
+	}
+	if strings.ContainsAny(name, " \t") {
+		return "", nil, fmt.Errorf("malformed header name %q", name)
+	}
+
+	// Collect the non-empty values.
+	values := []string{}
+	for _, value := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		value = strings.TrimSpace(value)
+		if len(value) != 0 {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return "", nil, fmt.Errorf("no values given for header %s", name)
+	}
+
+	return name, values, nil
+}
+
+// parseHostAliases parses "host=ip" pairs separated by commas or newlines into
+// a map keyed by the lowercase host name.
+func parseHostAliases(raw string) (map[string]string, error) {
+	// Split the pairs on commas and newlines.
+	aliases := make(map[string]string)
+	for index, entry := range strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		// Each pair needs a host name and a literal IP address.
+		host, ip, found := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		ip = strings.TrimSpace(ip)
+		if !found || len(host) == 0 {
+			return nil, fmt.Errorf("malformed alias %d, expected \"host=ip\"", index+1)
+		}
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("alias for %s has invalid IP address %q", host, ip)
+		}
+		aliases[host] = ip
+	}
+
+	return aliases, nil
+}
+
+// parseHeaderNames parses header names separated by commas or newlines.
+func parseHeaderNames(raw string) ([]string, error) {
+	// Split the names and reject malformed ones.
+	names := []string{}
+	for _, name := range strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if strings.ContainsAny(name, " \t:") {
+			return nil, fmt.Errorf("malformed header name %q", name)
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// hasHeader reports whether headers contains name, ignoring case.
+func hasHeader(headers map[string]string, name string) bool {
+	// Compare canonical header names.
+	for key := range headers {
+		if http.CanonicalHeaderKey(key) == http.CanonicalHeaderKey(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// envReferencePattern matches ${NAME} references, along with the $${NAME}
+// escape for a literal reference.
+var envReferencePattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references in the value of setting with the
+// named environment variables. Only the braced form is expanded so a bare $
+// in a body is left alone, and $${NAME} yields a literal ${NAME}. A reference
+// to an unset variable is an error, naming the variable but not the value.
+func expandEnv(setting string, raw string) (string, error) {
+	// Resolve each reference, remembering the first missing variable.
+	missing := ""
+	expanded := envReferencePattern.ReplaceAllStringFunc(raw, func(reference string) string {
+		if strings.HasPrefix(reference, "$$") {
+			return reference[1:]
+		}
+		name := reference[2 : len(reference)-1]
+		value, ok := os.LookupEnv(name)
+		if !ok && len(missing) == 0 {
+			missing = name
+		}
+		return value
+	})
+	if len(missing) != 0 {
+		return "", fmt.Errorf("%s references the unset environment variable %s", setting, missing)
+	}
+
+	return expanded, nil
+}
+
+// expandEnvLine expands ${NAME} references in a single URL or header value,
+// which must stay on one line. The error names setting but not the value.
+func expandEnvLine(setting string, raw string) (string, error) {
+	// Expand, then refuse values that would split the entry.
+	expanded, err := expandEnv(setting, raw)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(expanded, "\r\n") {
+		return "", fmt.Errorf("%s contains a line break after expanding environment variables", setting)
+	}
+
+	return expanded, nil
+}
+
+// expandTemplateEnv expands ${NAME} references in the literal text of a
+// parsed body template, so the values are sent as written rather than parsed
+// as template actions. References inside actions are left as written. A nil
+// template is left alone.
+func expandTemplateEnv(setting string, bodyTemplate *template.Template) error {
+	// Skip plain bodies.
+	if bodyTemplate == nil {
+		return nil
+	}
+
+	// Walk every template the body defines.
+	for _, defined := range bodyTemplate.Templates() {
+		if defined.Tree == nil {
+			continue
+		}
+		err := expandNodeEnv(setting, defined.Tree.Root)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expandNodeEnv expands ${NAME} references in the text nodes under node.
+func expandNodeEnv(setting string, node parse.Node) error {
+	// Recurse into lists and the branches of control actions.
+	switch typed := node.(type) {
+	case *parse.TextNode:
+		expanded, err := expandEnv(setting, string(typed.Text))
+		if err != nil {
+			return err
+		}
+		typed.Text = []byte(expanded)
+	case *parse.ListNode:
+		if typed == nil {
+			return nil
+		}
+		for _, child := range typed.Nodes {
+			err := expandNodeEnv(setting, child)
+			if err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		return expandBranchEnv(setting, &typed.BranchNode)
+	case *parse.RangeNode:
+		return expandBranchEnv(setting, &typed.BranchNode)
+	case *parse.WithNode:
+		return expandBranchEnv(setting, &typed.BranchNode)
+	}
+
+	return nil
+}
+
+// expandBranchEnv expands ${NAME} references in both lists of a branch.
+func expandBranchEnv(setting string, branch *parse.BranchNode) error {
+	// Expand the main list, then the else list when there is one.
+	err := expandNodeEnv(setting, branch.List)
+	if err != nil {
+		return err
+	}
+
+	return expandNodeEnv(setting, branch.ElseList)
+}
+
+// parseHeaders parses "Key: Value" entries separated by newlines, or by commas
+// when the input is a single line. With expand set, ${NAME} references are
+// expanded in each value after the entries are split, so a variable cannot
+// add headers.
+func parseHeaders(raw string, expand bool) (map[string]string, error) {
+	// Split entries on newlines, falling back to commas.
+	separator := "\n"
+	if !strings.Contains(raw, "\n") {
+		separator = ","
+	}
+
+	headers := make(map[string]string)
+	for index, entry := range strings.Split(raw, separator) {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		// Each entry must be a non-empty key followed by a colon.
+		key, value, found := strings.Cut(entry, ":")
+		key = strings.TrimSpace(key)
+		if !found || len(key) == 0 {
+			return nil, fmt.Errorf("malformed header entry %d, expected \"Key: Value\"", index+1)
+		}
+		if strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("malformed header name %q", key)
+		}
+		value = strings.TrimSpace(value)
+		if expand {
+			var err error
+			value, err = expandEnvLine("header "+key, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		headers[key] = value
+	}
+
+	return headers, nil
+}
+
+// parseExitCode parses EXIT_CODE_ON_FAILURE, which defaults to 0.
+func parseExitCode(value string) (int, error) {
+	// Keep the default when unset.
+	if len(value) == 0 {
+		return 0, nil
+	}
+	exitCode, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("error converting EXIT_CODE_ON_FAILURE to int: %w", err)
+	}
+	if exitCode < 0 || exitCode > 125 {
+		return 0, fmt.Errorf("EXIT_CODE_ON_FAILURE must be between 0 and 125, got %d", exitCode)
+	}
+
+	return exitCode, nil
+}
+
+// failureExitCode reads EXIT_CODE_ON_FAILURE from args, the environment, and
+// the config file for a config that failed to parse. Layers that cannot be
+// loaded are skipped, and an unusable value falls back to 0.
+func failureExitCode(args []string) int {
+	// Load what can be loaded, without printing the flag usage again.
+	source := &configSource{
+		flagValues: make(map[string]string),
+		fileValues: make(map[string]string),
+		specValues: make(map[string]string),
+		quiet:      true,
+	}
+	err := source.parseFlags(args)
+	if err != nil {
+		source.flagValues = make(map[string]string)
+	}
+	err = source.loadFile(source.values().ConfigFile)
+	if err != nil {
+		source.fileValues = make(map[string]string)
+	}
+
+	exitCode, err := parseExitCode(source.values().ExitCodeOnFailure)
+	if err != nil {
+		return 0
+	}
+	return exitCode
 }
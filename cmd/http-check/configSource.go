@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// settings holds the raw value of every setting, in the order they are
+// documented. The env tag names the environment variable, the flag tag the
+// command-line flag, and the file tag the config file key. By convention flag
+// names are the environment variable names in kebab case and file keys are
+// the names in camelCase, so CHECK_URL is set with -check-url or checkUrl.
+type settings struct {
+	// CheckURL lists the URLs to query.
+	CheckURL string `env:"CHECK_URL" flag:"check-url" file:"checkUrl"`
+	// CheckURLFile names a file listing more URLs to query.
+	CheckURLFile string `env:"CHECK_URL_FILE" flag:"check-url-file" file:"checkUrlFile"`
+	// Count is the number of requests sent to each URL.
+	Count string `env:"COUNT" flag:"count" file:"count"`
+	// Seconds is the pause between requests.
+	Seconds string `env:"SECONDS" flag:"seconds" file:"seconds"`
+	// PassingPercent is the percent of requests that must succeed.
+	PassingPercent string `env:"PASSING_PERCENT" flag:"passing-percent" file:"passingPercent"`
+	// MaxFailures is how many requests may fail.
+	MaxFailures string `env:"MAX_FAILURES" flag:"max-failures" file:"maxFailures"`
+	// PassOnAnySuccess passes the run when any request passed.
+	PassOnAnySuccess string `env:"PASS_ON_ANY_SUCCESS" flag:"pass-on-any-success" file:"passOnAnySuccess"`
+	// RequestType is the HTTP method.
+	RequestType string `env:"REQUEST_TYPE" flag:"request-type" file:"requestType"`
+	// RequestBody is the request body.
+	RequestBody string `env:"REQUEST_BODY" flag:"request-body" file:"requestBody"`
+	// RequestBodyFile names a file holding the request body.
+	RequestBodyFile string `env:"REQUEST_BODY_FILE" flag:"request-body-file" file:"requestBodyFile"`
+	// AllowEmptyBody allows body methods to send no body.
+	AllowEmptyBody string `env:"ALLOW_EMPTY_BODY" flag:"allow-empty-body" file:"allowEmptyBody"`
+	// ExpectedStatusCode lists the passing status codes.
+	ExpectedStatusCode string `env:"EXPECTED_STATUS_CODE" flag:"expected-status-code" file:"expectedStatusCode"`
+	// RequestTimeout is the per-request timeout.
+	RequestTimeout string `env:"REQUEST_TIMEOUT" flag:"request-timeout" file:"requestTimeout"`
+	// ExpectedBodyEquals is the exact body expected.
+	ExpectedBodyEquals string `env:"EXPECTED_BODY_EQUALS" flag:"expected-body-equals" file:"expectedBodyEquals"`
+	// ExpectedBodyContains is a substring the body must contain.
+	ExpectedBodyContains string `env:"EXPECTED_BODY_CONTAINS" flag:"expected-body-contains" file:"expectedBodyContains"`
+	// ExpectedBodyRegex is a pattern the body must match.
+	ExpectedBodyRegex string `env:"EXPECTED_BODY_REGEX" flag:"expected-body-regex" file:"expectedBodyRegex"`
+	// RequestHeaders lists extra request headers.
+	RequestHeaders string `env:"REQUEST_HEADERS" flag:"request-headers" file:"requestHeaders"`
+	// RotateHeaders names a header and the values it cycles through.
+	RotateHeaders string `env:"ROTATE_HEADERS" flag:"rotate-headers" file:"rotateHeaders"`
+	// BearerToken is the bearer token.
+	BearerToken string `env:"BEARER_TOKEN" flag:"bearer-token" file:"bearerToken"`
+	// BearerTokenFile names a file holding the bearer token.
+	BearerTokenFile string `env:"BEARER_TOKEN_FILE" flag:"bearer-token-file" file:"bearerTokenFile"`
+	// BasicAuthUsername is the basic auth username.
+	BasicAuthUsername string `env:"BASIC_AUTH_USERNAME" flag:"basic-auth-username" file:"basicAuthUsername"`
+	// BasicAuthPassword is the basic auth password.
+	BasicAuthPassword string `env:"BASIC_AUTH_PASSWORD" flag:"basic-auth-password" file:"basicAuthPassword"`
+	// InsecureSkipVerify disables TLS verification.
+	InsecureSkipVerify string `env:"INSECURE_SKIP_VERIFY" flag:"insecure-skip-verify" file:"insecureSkipVerify"`
+	// CACertFile names a bundle of extra trusted CAs.
+	CACertFile string `env:"CA_CERT_FILE" flag:"ca-cert-file" file:"caCertFile"`
+	// ClientCertFile names the mutual TLS client certificate.
+	ClientCertFile string `env:"CLIENT_CERT_FILE" flag:"client-cert-file" file:"clientCertFile"`
+	// ClientKeyFile names the mutual TLS client key.
+	ClientKeyFile string `env:"CLIENT_KEY_FILE" flag:"client-key-file" file:"clientKeyFile"`
+	// MaxResponseTimeMs is the slowest passing response.
+	MaxResponseTimeMs string `env:"MAX_RESPONSE_TIME_MS" flag:"max-response-time-ms" file:"maxResponseTimeMs"`
+	// Retries is how many times a failed request is retried.
+	Retries string `env:"RETRIES" flag:"retries" file:"retries"`
+	// RetryBackoffMs is the delay before the first retry.
+	RetryBackoffMs string `env:"RETRY_BACKOFF_MS" flag:"retry-backoff-ms" file:"retryBackoffMs"`
+	// RetryOnStatus lists the status codes that are retried.
+	RetryOnStatus string `env:"RETRY_ON_STATUS" flag:"retry-on-status" file:"retryOnStatus"`
+	// MaxRetryAfterSeconds caps the honored Retry-After delay.
+	MaxRetryAfterSeconds string `env:"MAX_RETRY_AFTER_SECONDS" flag:"max-retry-after-seconds" file:"maxRetryAfterSeconds"`
+	// FollowRedirects controls whether redirects are followed.
+	FollowRedirects string `env:"FOLLOW_REDIRECTS" flag:"follow-redirects" file:"followRedirects"`
+	// MaxRedirects caps how many redirects are followed.
+	MaxRedirects string `env:"MAX_REDIRECTS" flag:"max-redirects" file:"maxRedirects"`
+	// MetricsPort is the port serving Prometheus metrics.
+	MetricsPort string `env:"METRICS_PORT" flag:"metrics-port" file:"metricsPort"`
+	// Concurrency is the number of workers.
+	Concurrency string `env:"CONCURRENCY" flag:"concurrency" file:"concurrency"`
+	// RequireHTTP2 requires HTTP/2 to be negotiated.
+	RequireHTTP2 string `env:"REQUIRE_HTTP2" flag:"require-http2" file:"requireHttp2"`
+	// ProxyURL is the proxy for every request.
+	ProxyURL string `env:"PROXY_URL" flag:"proxy-url" file:"proxyUrl"`
+	// ExpectedJSONPath is a path that must exist in the JSON body.
+	ExpectedJSONPath string `env:"EXPECTED_JSON_PATH" flag:"expected-json-path" file:"expectedJsonPath"`
+	// ExpectedJSONValue is the value expected at the JSON path.
+	ExpectedJSONValue string `env:"EXPECTED_JSON_VALUE" flag:"expected-json-value" file:"expectedJsonValue"`
+	// CheckDeadlineSeconds bounds the whole run.
+	CheckDeadlineSeconds string `env:"CHECK_DEADLINE_SECONDS" flag:"check-deadline-seconds" file:"checkDeadlineSeconds"`
+	// MaxDNSTimeMs is the slowest passing DNS lookup.
+	MaxDNSTimeMs string `env:"MAX_DNS_TIME_MS" flag:"max-dns-time-ms" file:"maxDnsTimeMs"`
+	// ExpectedContentEncoding is the Content-Encoding expected.
+	ExpectedContentEncoding string `env:"EXPECTED_CONTENT_ENCODING" flag:"expected-content-encoding" file:"expectedContentEncoding"`
+	// AcceptEncoding is the Accept-Encoding sent.
+	AcceptEncoding string `env:"ACCEPT_ENCODING" flag:"accept-encoding" file:"acceptEncoding"`
+	// MinCompressionRatio is the smallest passing compression ratio.
+	MinCompressionRatio string `env:"MIN_COMPRESSION_RATIO" flag:"min-compression-ratio" file:"minCompressionRatio"`
+	// ExpectedHeaders lists the response headers expected.
+	ExpectedHeaders string `env:"EXPECTED_HEADERS" flag:"expected-headers" file:"expectedHeaders"`
+	// ForbiddenHeaders lists the response headers that must be absent.
+	ForbiddenHeaders string `env:"FORBIDDEN_HEADERS" flag:"forbidden-headers" file:"forbiddenHeaders"`
+	// WarmupRequests is how many uncounted requests go first.
+	WarmupRequests string `env:"WARMUP_REQUESTS" flag:"warmup-requests" file:"warmupRequests"`
+	// ConfigFile names the YAML or JSON settings file.
+	ConfigFile string `env:"CONFIG_FILE" flag:"config-file" file:"configFile"`
+	// LoginURL is requested before the check for session cookies.
+	LoginURL string `env:"LOGIN_URL" flag:"login-url" file:"loginUrl"`
+	// LoginRequestType is the login HTTP method.
+	LoginRequestType string `env:"LOGIN_REQUEST_TYPE" flag:"login-request-type" file:"loginRequestType"`
+	// LoginRequestBody is the login request body.
+	LoginRequestBody string `env:"LOGIN_REQUEST_BODY" flag:"login-request-body" file:"loginRequestBody"`
+	// RequestCookies lists the cookies sent with every request.
+	RequestCookies string `env:"REQUEST_COOKIES" flag:"request-cookies" file:"requestCookies"`
+	// LogFormat is the log output format.
+	LogFormat string `env:"LOG_FORMAT" flag:"log-format" file:"logFormat"`
+	// LogLevel is the minimum log level.
+	LogLevel string `env:"LOG_LEVEL" flag:"log-level" file:"logLevel"`
+	// DryRun logs the resolved config and exits.
+	DryRun string `env:"DRY_RUN" flag:"dry-run" file:"dryRun"`
+	// RedactQueryParams lists the query parameters masked in logs.
+	RedactQueryParams string `env:"REDACT_QUERY_PARAMS" flag:"redact-query-params" file:"redactQueryParams"`
+	// MinTLSVersion is the lowest accepted TLS version.
+	MinTLSVersion string `env:"MIN_TLS_VERSION" flag:"min-tls-version" file:"minTlsVersion"`
+	// AssertMinTLSVersion checks the TLS version after the handshake.
+	AssertMinTLSVersion string `env:"ASSERT_MIN_TLS_VERSION" flag:"assert-min-tls-version" file:"assertMinTlsVersion"`
+	// CertExpiryWarningDays is the certificate expiry warning window.
+	CertExpiryWarningDays string `env:"CERT_EXPIRY_WARNING_DAYS" flag:"cert-expiry-warning-days" file:"certExpiryWarningDays"`
+	// CertExpiryFail fails instead of warning on expiry.
+	CertExpiryFail string `env:"CERT_EXPIRY_FAIL" flag:"cert-expiry-fail" file:"certExpiryFail"`
+	// HostOverride is the Host header and TLS server name.
+	HostOverride string `env:"HOST_OVERRIDE" flag:"host-override" file:"hostOverride"`
+	// StatusWeights scores each response status.
+	StatusWeights string `env:"STATUS_WEIGHTS" flag:"status-weights" file:"statusWeights"`
+	// DisableKeepAlive opens a fresh connection per request.
+	DisableKeepAlive string `env:"DISABLE_KEEPALIVE" flag:"disable-keepalive" file:"disableKeepalive"`
+	// MaxIdleConns caps the idle connections kept.
+	MaxIdleConns string `env:"MAX_IDLE_CONNS" flag:"max-idle-conns" file:"maxIdleConns"`
+	// SecondsBackoffFactor grows the pause after each request.
+	SecondsBackoffFactor string `env:"SECONDS_BACKOFF_FACTOR" flag:"seconds-backoff-factor" file:"secondsBackoffFactor"`
+	// SecondsMax caps the growing pause.
+	SecondsMax string `env:"SECONDS_MAX" flag:"seconds-max" file:"secondsMax"`
+	// RequestContentType is the Content-Type of request bodies.
+	RequestContentType string `env:"REQUEST_CONTENT_TYPE" flag:"request-content-type" file:"requestContentType"`
+	// RequestForm lists URL-encoded form fields.
+	RequestForm string `env:"REQUEST_FORM" flag:"request-form" file:"requestForm"`
+	// RequestMultipart lists multipart form fields.
+	RequestMultipart string `env:"REQUEST_MULTIPART" flag:"request-multipart" file:"requestMultipart"`
+	// InitialDelaySeconds is the wait before the first request.
+	InitialDelaySeconds string `env:"INITIAL_DELAY_SECONDS" flag:"initial-delay-seconds" file:"initialDelaySeconds"`
+	// CacheBust adds a unique query parameter to each request.
+	CacheBust string `env:"CACHE_BUST" flag:"cache-bust" file:"cacheBust"`
+	// MaxBodyBytes caps how much of a body is read.
+	MaxBodyBytes string `env:"MAX_BODY_BYTES" flag:"max-body-bytes" file:"maxBodyBytes"`
+	// MaxResponseHeaderBytes caps the response header size.
+	MaxResponseHeaderBytes string `env:"MAX_RESPONSE_HEADER_BYTES" flag:"max-response-header-bytes" file:"maxResponseHeaderBytes"`
+	// FailOnLargeBody fails bodies longer than the cap.
+	FailOnLargeBody string `env:"FAIL_ON_LARGE_BODY" flag:"fail-on-large-body" file:"failOnLargeBody"`
+	// IPVersion pins connections to IPv4 or IPv6.
+	IPVersion string `env:"IP_VERSION" flag:"ip-version" file:"ipVersion"`
+	// NotifyWebhookURL is notified of failures.
+	NotifyWebhookURL string `env:"NOTIFY_WEBHOOK_URL" flag:"notify-webhook-url" file:"notifyWebhookUrl"`
+	// SummaryJSON prints the summary as JSON.
+	SummaryJSON string `env:"SUMMARY_JSON" flag:"summary-json" file:"summaryJson"`
+	// UserAgent is the User-Agent sent.
+	UserAgent string `env:"USER_AGENT" flag:"user-agent" file:"userAgent"`
+	// ExpectedFinalURL is where the request must land.
+	ExpectedFinalURL string `env:"EXPECTED_FINAL_URL" flag:"expected-final-url" file:"expectedFinalUrl"`
+	// EarlyExit stops once the run can no longer pass.
+	EarlyExit string `env:"EARLY_EXIT" flag:"early-exit" file:"earlyExit"`
+	// RequestIfNoneMatch is the If-None-Match sent.
+	RequestIfNoneMatch string `env:"REQUEST_IF_NONE_MATCH" flag:"request-if-none-match" file:"requestIfNoneMatch"`
+	// JitterPercent randomizes each pause.
+	JitterPercent string `env:"JITTER_PERCENT" flag:"jitter-percent" file:"jitterPercent"`
+	// RandomSeed seeds the jitter.
+	RandomSeed string `env:"RANDOM_SEED" flag:"random-seed" file:"randomSeed"`
+	// ExpectedJSONSchemaFile names the schema the JSON body must match.
+	ExpectedJSONSchemaFile string `env:"EXPECTED_JSON_SCHEMA_FILE" flag:"expected-json-schema-file" file:"expectedJsonSchemaFile"`
+	// MaxTTFBMs is the slowest passing first byte.
+	MaxTTFBMs string `env:"MAX_TTFB_MS" flag:"max-ttfb-ms" file:"maxTtfbMs"`
+	// HealthPort is the port serving /healthz.
+	HealthPort string `env:"HEALTH_PORT" flag:"health-port" file:"healthPort"`
+	// HealthMaxAgeSeconds is the longest gap /healthz allows.
+	HealthMaxAgeSeconds string `env:"HEALTH_MAX_AGE_SECONDS" flag:"health-max-age-seconds" file:"healthMaxAgeSeconds"`
+	// ReportTimeoutSeconds bounds the Kuberhealthy report.
+	ReportTimeoutSeconds string `env:"REPORT_TIMEOUT_SECONDS" flag:"report-timeout-seconds" file:"reportTimeoutSeconds"`
+	// ExitCodeOnFailure is the exit code after a failure.
+	ExitCodeOnFailure string `env:"EXIT_CODE_ON_FAILURE" flag:"exit-code-on-failure" file:"exitCodeOnFailure"`
+	// ResponseSpecFile names the response expectations file.
+	ResponseSpecFile string `env:"RESPONSE_SPEC_FILE" flag:"response-spec-file" file:"responseSpecFile"`
+	// RequireKHEndpoint requires Kuberhealthy to be reachable first.
+	RequireKHEndpoint string `env:"REQUIRE_KH_ENDPOINT" flag:"require-kh-endpoint" file:"requireKhEndpoint"`
+	// FailFastOnDNS resolves every host before the run.
+	FailFastOnDNS string `env:"FAIL_FAST_ON_DNS" flag:"fail-fast-on-dns" file:"failFastOnDns"`
+	// Protocol selects how each URL is checked.
+	Protocol string `env:"PROTOCOL" flag:"protocol" file:"protocol"`
+	// GRPCService is the gRPC health service name.
+	GRPCService string `env:"GRPC_SERVICE" flag:"grpc-service" file:"grpcService"`
+	// WebSocketPing pings after a WebSocket upgrade.
+	WebSocketPing string `env:"WEBSOCKET_PING" flag:"websocket-ping" file:"websocketPing"`
+	// MaxP95Ms is the slowest passing 95th percentile.
+	MaxP95Ms string `env:"MAX_P95_MS" flag:"max-p95-ms" file:"maxP95Ms"`
+	// MaxP99Ms is the slowest passing 99th percentile.
+	MaxP99Ms string `env:"MAX_P99_MS" flag:"max-p99-ms" file:"maxP99Ms"`
+	// DialTimeoutMs bounds each connection attempt.
+	DialTimeoutMs string `env:"DIAL_TIMEOUT_MS" flag:"dial-timeout-ms" file:"dialTimeoutMs"`
+	// SuccessJSONPath names a value to extract from passing bodies.
+	SuccessJSONPath string `env:"SUCCESS_JSON_PATH" flag:"success-json-path" file:"successJsonPath"`
+	// HostAliases maps hosts to the addresses dialed.
+	HostAliases string `env:"HOST_ALIASES" flag:"host-aliases" file:"hostAliases"`
+	// TrailingWindow is how many final checks must all pass.
+	TrailingWindow string `env:"TRAILING_WINDOW" flag:"trailing-window" file:"trailingWindow"`
+	// ExpectedStreamLine is a line a streamed body must send.
+	ExpectedStreamLine string `env:"EXPECTED_STREAM_LINE" flag:"expected-stream-line" file:"expectedStreamLine"`
+	// IdempotencyCheck repeats each passing request and compares.
+	IdempotencyCheck string `env:"IDEMPOTENCY_CHECK" flag:"idempotency-check" file:"idempotencyCheck"`
+}
+
+// settingField names one settings field in each source.
+type settingField struct {
+	// index is the position of the field in settings.
+	index int
+	// env is the environment variable name.
+	env string
+	// flag is the command-line flag name.
+	flag string
+	// file is the config file key.
+	file string
+}
+
+// settingFields describes every settings field, read from its tags.
+var settingFields = newSettingFields()
+
+// newSettingFields reads the source names of every settings field from its
+// struct tags.
+func newSettingFields() []settingField {
+	// Walk the fields in declaration order.
+	settingsType := reflect.TypeOf(settings{})
+	fields := make([]settingField, 0, settingsType.NumField())
+	for i := 0; i < settingsType.NumField(); i++ {
+		tag := settingsType.Field(i).Tag
+		fields = append(fields, settingField{
+			index: i,
+			env:   tag.Get("env"),
+			flag:  tag.Get("flag"),
+			file:  tag.Get("file"),
+		})
+	}
+
+	return fields
+}
+
+// configSource resolves configuration values from command-line flags, then
+// the environment, then an optional response spec file, then an optional YAML
+// or JSON config file, using the names in the settings tags.
+type configSource struct {
+	// flagValues holds the flags given on the command line keyed by
+	// environment variable name.
+	flagValues map[string]string
+	// fileValues holds the config file values keyed by file key.
+	fileValues map[string]string
+	// specValues holds the response spec file values keyed by environment
+	// variable name.
+	specValues map[string]string
+	// quiet suppresses the usage output when the flags fail to parse.
+	quiet bool
+}
+
+// newConfigSource parses the command-line args and loads the config file they
+// or the environment name in CONFIG_FILE. Without a config file the source is
+// backed only by flags and the environment.
+func newConfigSource(args []string) (*configSource, error) {
+	// Start with empty flag and file layers.
+	source := &configSource{
+		flagValues: make(map[string]string),
+		fileValues: make(map[string]string),
+		specValues: make(map[string]string),
+	}
+
+	// Parse the flags.
+	err := source.parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the config file when one is named.
+	err = source.loadFile(source.values().ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the response spec file, which may itself be named in the config
+	// file.
+	err = source.loadSpecFile(source.values().ResponseSpecFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// parseFlags records every setting given as a flag in args.
+func (s *configSource) parseFlags(args []string) error {
+	// Define a string flag for every setting.
+	flags := flag.NewFlagSet("http-check", flag.ContinueOnError)
+	if s.quiet {
+		flags.SetOutput(io.Discard)
+	}
+	values := make([]*string, len(settingFields))
+	for _, field := range settingFields {
+		values[field.index] = flags.String(field.flag, "", "overrides the "+field.env+" environment variable")
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return fmt.Errorf("error parsing flags: %w", err)
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	// Keep only the flags that were given, even when set to an empty value.
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for _, field := range settingFields {
+		if given[field.flag] {
+			s.flagValues[field.env] = *values[field.index]
+		}
+	}
+
+	return nil
+}
+
+// loadFile loads the config file at path. An empty path loads nothing.
+func (s *configSource) loadFile(path string) error {
+	// Skip when no file is named.
+	if len(path) == 0 {
+		return nil
+	}
+
+	// Read and decode the file.
+	values, err := decodeSettingsFile("CONFIG_FILE", path)
+	if err != nil {
+		return err
+	}
+
+	// Flatten each value into the string form the environment would use.
+	for key, value := range values {
+		text, err := fileValueString(value)
+		if err != nil {
+			return fmt.Errorf("error parsing CONFIG_FILE key %s: %w", key, err)
+		}
+		s.fileValues[key] = text
+	}
+
+	return nil
+}
+
+// responseSpecKeys maps the top-level keys of a response spec file to the
+// settings they set.
+var responseSpecKeys = map[string]string{
+	"status":            "EXPECTED_STATUS_CODE",
+	"headers":           "EXPECTED_HEADERS",
+	"forbiddenHeaders":  "FORBIDDEN_HEADERS",
+	"contentEncoding":   "EXPECTED_CONTENT_ENCODING",
+	"finalUrl":          "EXPECTED_FINAL_URL",
+	"maxResponseTimeMs": "MAX_RESPONSE_TIME_MS",
+	"maxTtfbMs":         "MAX_TTFB_MS",
+}
+
+// responseSpecBodyKeys maps the keys under a response spec file's body key to
+// the settings they set.
+var responseSpecBodyKeys = map[string]string{
+	"equals":         "EXPECTED_BODY_EQUALS",
+	"contains":       "EXPECTED_BODY_CONTAINS",
+	"regex":          "EXPECTED_BODY_REGEX",
+	"jsonPath":       "EXPECTED_JSON_PATH",
+	"jsonValue":      "EXPECTED_JSON_VALUE",
+	"jsonSchemaFile": "EXPECTED_JSON_SCHEMA_FILE",
+}
+
+// loadSpecFile loads the response spec file at path, which declares every
+// response expectation in one place. An empty path loads nothing.
+func (s *configSource) loadSpecFile(path string) error {
+	// Skip when no file is named.
+	if len(path) == 0 {
+		return nil
+	}
+
+	// Read and decode the file.
+	values, err := decodeSettingsFile("RESPONSE_SPEC_FILE", path)
+	if err != nil {
+		return err
+	}
+
+	// Map each key to its setting, descending into the body matchers.
+	for key, value := range values {
+		if key == "body" {
+			body, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("error parsing RESPONSE_SPEC_FILE key body: expected a mapping of matchers")
+			}
+			err = s.addSpecValues(body, responseSpecBodyKeys, "body.")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = s.addSpecValues(map[string]any{key: value}, responseSpecKeys, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addSpecValues records the spec values in values using the settings named
+// in keys. prefix qualifies the keys in errors.
+func (s *configSource) addSpecValues(values map[string]any, keys map[string]string, prefix string) error {
+	// Reject keys that name no expectation.
+	for key, value := range values {
+		name, ok := keys[key]
+		if !ok {
+			return fmt.Errorf("unknown key in RESPONSE_SPEC_FILE: %s%s", prefix, key)
+		}
+		text, err := fileValueString(value)
+		if err != nil {
+			return fmt.Errorf("error parsing RESPONSE_SPEC_FILE key %s%s: %w", prefix, key, err)
+		}
+		s.specValues[name] = text
+	}
+
+	return nil
+}
+
+// decodeSettingsFile reads a YAML or JSON mapping from path. YAML is
+// converted to JSON first so both formats share one decoder. setting names the
+// variable that pointed at the file, for errors.
+func decodeSettingsFile(setting string, path string) (map[string]any, error) {
+	// Read the file.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", setting, err)
+	}
+
+	// Decode it, keeping numbers in their original form.
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s %s: %w", setting, path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	values := map[string]any{}
+	err = decoder.Decode(&values)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s %s: expected a mapping of settings: %w", setting, path, err)
+	}
+
+	return values, nil
+}
+
+// values resolves every setting from the sources.
+func (s *configSource) values() *settings {
+	// Fill each field from the source names in its tags.
+	resolved := &settings{}
+	fields := reflect.ValueOf(resolved).Elem()
+	for _, field := range settingFields {
+		fields.Field(field.index).SetString(s.get(field))
+	}
+
+	return resolved
+}
+
+// get returns the value for a setting, preferring a flag, then the
+// environment, then the response spec file, then the config file.
+func (s *configSource) get(field settingField) string {
+	// A flag given on the command line always wins.
+	flagValue, ok := s.flagValues[field.env]
+	if ok {
+		return flagValue
+	}
+
+	value, ok := os.LookupEnv(field.env)
+	if ok && len(value) != 0 {
+		return value
+	}
+
+	specValue, ok := s.specValues[field.env]
+	if ok {
+		return specValue
+	}
+
+	return s.fileValues[field.file]
+}
+
+// unknownKeys returns the config file keys that name no setting.
+func (s *configSource) unknownKeys() []string {
+	// Collect keys no settings field is read from.
+	known := make(map[string]bool, len(settingFields))
+	for _, field := range settingFields {
+		known[field.file] = true
+	}
+	unknown := []string{}
+	for key := range s.fileValues {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+// fileValueString renders a decoded config file value as an environment
+// variable string. Lists are joined with commas and mappings become
+// "Key: Value" lines, matching the list and header formats.
+func fileValueString(value any) (string, error) {
+	// Convert by decoded JSON type.
+	switch typed := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return typed, nil
+	case json.Number:
+		return typed.String(), nil
+	case bool:
+		return fmt.Sprint(typed), nil
+	case []any:
+		parts := make([]string, 0, len(typed))
+		for _, item := range typed {
+			text, err := fileValueString(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, text)
+		}
+		return strings.Join(parts, ","), nil
+	case map[string]any:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		lines := make([]string, 0, len(keys))
+		for _, key := range keys {
+			text, err := fileValueString(typed[key])
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines, key+": "+text)
+		}
+		return strings.Join(lines, "\n"), nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", value)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSettingTags checks every settings field carries an environment
+// variable, flag, and file key that follow the naming convention and name no
+// other setting.
+func TestSettingTags(t *testing.T) {
+	settingsType := reflect.TypeOf(settings{})
+	if len(settingFields) != settingsType.NumField() {
+		t.Fatalf("got %d setting fields for %d struct fields", len(settingFields), settingsType.NumField())
+	}
+	seen := map[string]string{}
+	for _, field := range settingFields {
+		structField := settingsType.Field(field.index)
+		if structField.Type.Kind() != reflect.String {
+			t.Errorf("%s is a %s, want a string", structField.Name, structField.Type)
+		}
+		if len(field.env) == 0 || strings.ToUpper(field.env) != field.env {
+			t.Errorf("%s has env tag %q, want an upper case name", structField.Name, field.env)
+		}
+
+		// Flags are the name in kebab case and file keys in camelCase.
+		wantFlag := strings.ReplaceAll(strings.ToLower(field.env), "_", "-")
+		if field.flag != wantFlag {
+			t.Errorf("%s has flag tag %q, want %q", structField.Name, field.flag, wantFlag)
+		}
+		words := strings.Split(strings.ToLower(field.env), "_")
+		for i := 1; i < len(words); i++ {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+		wantFile := strings.Join(words, "")
+		if field.file != wantFile {
+			t.Errorf("%s has file tag %q, want %q", structField.Name, field.file, wantFile)
+		}
+
+		// No two fields may share a name in any source.
+		for _, name := range []string{field.env, field.flag, field.file} {
+			other, ok := seen[name]
+			if ok && other != structField.Name {
+				t.Errorf("%s and %s are both named %q", other, structField.Name, name)
+			}
+			seen[name] = structField.Name
+		}
+	}
+}
+
+// TestParseConfigLayering checks flags override the environment, which
+// overrides the response spec file, which overrides the config file.
+func TestParseConfigLayering(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		args        []string
+		configFile  string
+		specFile    string
+		wantCount   int
+		wantStatus  string
+		wantContain string
+		wantErr     string
+	}{
+		{
+			name:       "defaults",
+			wantCount:  1,
+			wantStatus: "200",
+		},
+		{
+			name:        "config file",
+			configFile:  "count: 2\nexpectedStatusCode: 201\nexpectedBodyContains: file\n",
+			wantCount:   2,
+			wantStatus:  "201",
+			wantContain: "file",
+		},
+		{
+			name:        "spec file over config file",
+			configFile:  "expectedStatusCode: 201\n",
+			specFile:    "status: 202\nbody:\n  contains: spec\n",
+			wantCount:   1,
+			wantStatus:  "202",
+			wantContain: "spec",
+		},
+		{
+			name:       "spec file named in config file",
+			configFile: "responseSpecFile: SPEC\n",
+			specFile:   "status: 202\n",
+			wantCount:  1,
+			wantStatus: "202",
+		},
+		{
+			name:       "environment over files",
+			env:        map[string]string{"COUNT": "3", "EXPECTED_STATUS_CODE": "203"},
+			configFile: "count: 2\n",
+			specFile:   "status: 202\n",
+			wantCount:  3,
+			wantStatus: "203",
+		},
+		{
+			name:       "empty environment variable falls through",
+			env:        map[string]string{"COUNT": ""},
+			configFile: "count: 2\n",
+			wantCount:  2,
+			wantStatus: "200",
+		},
+		{
+			name:        "flag over environment",
+			env:         map[string]string{"COUNT": "3", "EXPECTED_BODY_CONTAINS": "env"},
+			args:        []string{"-count", "4", "-expected-body-contains", ""},
+			configFile:  "expectedBodyContains: file\n",
+			wantCount:   4,
+			wantStatus:  "200",
+			wantContain: "",
+		},
+		{
+			name:       "unknown config file key",
+			configFile: "count: 2\nexpectedStatus: 201\n",
+			wantErr:    "unknown keys in CONFIG_FILE: expectedStatus",
+		},
+		{
+			name:     "unknown spec file key",
+			specFile: "statusCode: 202\n",
+			wantErr:  "unknown key in RESPONSE_SPEC_FILE: statusCode",
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"-expected-status", "201"},
+			wantErr: "error parsing flags",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			args := append([]string{"-check-url", "https://example.com"}, test.args...)
+			specPath := ""
+			if len(test.specFile) != 0 {
+				specPath = writeTestFile(t, "spec.yaml", []byte(test.specFile))
+			}
+			if len(test.configFile) != 0 {
+				configFile := strings.ReplaceAll(test.configFile, "SPEC", specPath)
+				args = append(args, "-config-file", writeTestFile(t, "config.yaml", []byte(configFile)))
+			}
+			if len(specPath) != 0 && !strings.Contains(test.configFile, "SPEC") {
+				args = append(args, "-response-spec-file", specPath)
+			}
+
+			cfg, err := parseConfig(args)
+			if len(test.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("parseConfig error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseConfig returned an error: %v", err)
+			}
+			if cfg.Count != test.wantCount {
+				t.Errorf("Count = %d, want %d", cfg.Count, test.wantCount)
+			}
+			if cfg.ExpectedStatus.String() != test.wantStatus {
+				t.Errorf("ExpectedStatus = %s, want %s", cfg.ExpectedStatus, test.wantStatus)
+			}
+			if cfg.ExpectedBodyContains != test.wantContain {
+				t.Errorf("ExpectedBodyContains = %q, want %q", cfg.ExpectedBodyContains, test.wantContain)
+			}
+		})
+	}
+}
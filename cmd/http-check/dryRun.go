@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/kuberhealthy/http-check/pkg/httpcheck"
+	log "github.com/sirupsen/logrus"
+)
+
+// redactedSetting replaces setting values that must not be logged.
+const redactedSetting = "[redacted]"
+
+// secretSettings lists the Config fields whose values are never logged.
+var secretSettings = map[string]bool{
+	"BearerToken":       true,
+	"BasicAuthPassword": true,
+	"LoginRequestBody":  true,
+}
+
+// secretHeaderSettings lists the Config fields holding headers whose values
+// are never logged.
+var secretHeaderSettings = map[string]bool{
+	"Headers": true,
+}
+
+// logResolvedConfig logs every resolved setting with secrets redacted.
+func logResolvedConfig(cfg *CheckConfig) {
+	// Render each check setting by name.
+	fields := log.Fields{}
+	value := reflect.ValueOf(cfg.Config).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Name
+		field := value.Field(i)
+		if field.Kind() == reflect.Func {
+			continue
+		}
+		fields[name] = settingString(cfg.Config, name, field.Interface())
+	}
+
+	// Hide a body that environment variables were expanded into.
+	if cfg.RedactRequestBody && len(cfg.RequestBody) != 0 {
+		fields["RequestBody"] = redactedSetting
+	}
+
+	// Add the command-only settings.
+	fields["MetricsPort"] = cfg.MetricsPort
+	fields["LogFormat"] = cfg.LogFormat
+	fields["LogLevel"] = cfg.LogLevel.String()
+	fields["HealthPort"] = cfg.HealthPort
+	fields["HealthMaxAgeSeconds"] = cfg.HealthMaxAgeSeconds
+	fields["ReportTimeoutSeconds"] = cfg.ReportTimeoutSeconds
+	fields["ExitCodeOnFailure"] = cfg.ExitCodeOnFailure
+	fields["SummaryJSON"] = cfg.SummaryJSON
+	fields["MaxP95Ms"] = cfg.MaxP95Ms
+	fields["MaxP99Ms"] = cfg.MaxP99Ms
+	fields["RequireKHEndpoint"] = cfg.RequireKHEndpoint
+	fields["FailFastOnDNS"] = cfg.FailFastOnDNS
+	fields["NotifyWebhookURL"] = ""
+	if cfg.NotifyWebhookURL != nil {
+		fields["NotifyWebhookURL"] = redactedSetting
+	}
+
+	log.WithFields(fields).Infoln("Dry run: resolved configuration. No checks were run.")
+}
+
+// settingString renders a setting value for logging, redacting credentials.
+func settingString(cfg *httpcheck.Config, name string, value any) string {
+	// Redact secrets that are set.
+	if secretSettings[name] {
+		if reflect.ValueOf(value).IsZero() {
+			return ""
+		}
+		return redactedSetting
+	}
+
+	// Render by type.
+	switch typed := value.(type) {
+	case *url.URL:
+		if typed == nil {
+			return ""
+		}
+		return cfg.RedactURL(typed)
+	case []*url.URL:
+		return redactedURLs(cfg, typed)
+	case map[string]string:
+		entries := make([]string, 0, len(typed))
+		for key, headerValue := range typed {
+			if secretHeaderSettings[name] {
+				headerValue = redactedSetting
+			}
+			entries = append(entries, key+": "+headerValue)
+		}
+		sort.Strings(entries)
+		return strings.Join(entries, ", ")
+	case []*http.Cookie:
+		names := make([]string, 0, len(typed))
+		for _, cookie := range typed {
+			names = append(names, cookie.Name+"="+redactedSetting)
+		}
+		return strings.Join(names, "; ")
+	case *x509.CertPool:
+		if typed == nil {
+			return "system roots"
+		}
+		return "system roots plus CA_CERT_FILE"
+	case *template.Template:
+		if typed == nil {
+			return ""
+		}
+		return "rendered from RequestBody"
+	case *httpcheck.JSONSchema:
+		if typed == nil {
+			return ""
+		}
+		return "loaded from EXPECTED_JSON_SCHEMA_FILE"
+	case []tls.Certificate:
+		return fmt.Sprintf("%d client certificates", len(typed))
+	default:
+		if reflect.ValueOf(value).Kind() == reflect.Pointer && reflect.ValueOf(value).IsNil() {
+			return ""
+		}
+		return fmt.Sprint(value)
+	}
+}
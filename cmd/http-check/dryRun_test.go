@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TestLogResolvedConfigRequestBody checks the dry run hides a body that
+// environment variables were expanded into and shows any other body.
+func TestLogResolvedConfigRequestBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantShown bool
+		// marker appears in the log when the body is shown.
+		marker string
+	}{
+		{name: "expanded body", body: `{"token":"${TEST_TOKEN}"}`, marker: "s3cret"},
+		{name: "expanded template body", body: `{"id":"{{.UUID}}","token":"${TEST_TOKEN}"}`, marker: "s3cret"},
+		{name: "plain body", body: `{"probe":"visible"}`, wantShown: true, marker: "visible"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TEST_TOKEN", "s3cret")
+			cfg, err := parseConfig([]string{"-check-url", "https://example.com", "-request-type", "POST", "-request-body", test.body})
+			if err != nil {
+				t.Fatalf("parseConfig returned an error: %v", err)
+			}
+
+			// Capture the dry run log.
+			var output bytes.Buffer
+			log.SetOutput(&output)
+			defer log.SetOutput(io.Discard)
+			logResolvedConfig(cfg)
+
+			shown := strings.Contains(output.String(), test.marker)
+			if shown != test.wantShown {
+				t.Errorf("body shown = %v, want %v, log: %s", shown, test.wantShown, output.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkerHealth tracks when the check loop last made progress so a liveness
+// probe can tell a wedged checker from a failing target.
+type checkerHealth struct {
+	// lastBeat is the time of the last heartbeat, in Unix nanoseconds.
+	lastBeat atomic.Int64
+	// maxAge is how old the last heartbeat may be before the checker is
+	// reported unhealthy.
+	maxAge time.Duration
+}
+
+// newCheckerHealth creates a tracker with a heartbeat recorded now.
+func newCheckerHealth(maxAge time.Duration) *checkerHealth {
+	// Start healthy so the probe passes before the first check completes.
+	h := &checkerHealth{maxAge: maxAge}
+	h.beat()
+	return h
+}
+
+// beat records that the check loop made progress. It is a no-op on a nil
+// receiver so callers do not need to check whether the endpoint is enabled.
+func (h *checkerHealth) beat() {
+	// Skip when the health endpoint is disabled.
+	if h == nil {
+		return
+	}
+	h.beatAt(time.Now())
+}
+
+// waiting records that a worker is about to block for up to delay without
+// completing a check, so the heartbeat counts as fresh until the wait ends.
+// Pacing pauses, retries, and slow requests may legitimately outlast maxAge.
+// It is a no-op on a nil receiver.
+func (h *checkerHealth) waiting(delay time.Duration) {
+	// Skip when the health endpoint is disabled.
+	if h == nil {
+		return
+	}
+	h.beatAt(time.Now().Add(delay))
+}
+
+// beatAt moves the heartbeat forward to at. It never moves it back, so one
+// worker completing a check does not cut short another worker's wait.
+func (h *checkerHealth) beatAt(at time.Time) {
+	// Retry until the stored heartbeat is at least at.
+	next := at.UnixNano()
+	for {
+		last := h.lastBeat.Load()
+		if last >= next || h.lastBeat.CompareAndSwap(last, next) {
+			return
+		}
+	}
+}
+
+// keepAlive beats every half of maxAge until the returned function is called.
+// It covers the initial delay, login, and warm-up, which complete no measured
+// checks but are bounded by their own timeouts. The returned function may be
+// called any number of times, and is a no-op on a nil receiver.
+func (h *checkerHealth) keepAlive() func() {
+	// Skip when the health endpoint is disabled.
+	if h == nil {
+		return func() {}
+	}
+
+	// Beat in the background until stopped.
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(h.maxAge / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.beat()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
+// ServeHTTP answers 200 while the last heartbeat is recent and 503 otherwise.
+func (h *checkerHealth) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	// Compare the heartbeat age with the limit. A heartbeat at the end of a
+	// pending wait is in the future and counts as fresh.
+	age := time.Since(time.Unix(0, h.lastBeat.Load()))
+	if age > h.maxAge {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "stale: no check completed in %s\n", age.Round(time.Millisecond))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// startHealthServer serves the liveness endpoint on /healthz at port.
+func startHealthServer(port int, h *checkerHealth) *http.Server {
+	// Expose only the heartbeat.
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", h)
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Serve in the background.
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorln("Health server stopped with error:", err)
+		}
+	}()
+	log.Infoln("Serving liveness on port", port, "at /healthz")
+
+	return server
+}
+
+// stopHealthServer gracefully shuts down the health server when it is running.
+func stopHealthServer(server *http.Server) {
+	// Skip when the health endpoint is disabled.
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if err != nil {
+		log.Errorln("Error shutting down health server:", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCheckerHealthKeepAlive checks the heartbeat stays fresh while the keep
+// alive runs, longer than the allowed age, and goes stale once it stops.
+func TestCheckerHealthKeepAlive(t *testing.T) {
+	maxAge := 100 * time.Millisecond
+	health := newCheckerHealth(maxAge)
+	stopKeepAlive := health.keepAlive()
+
+	// A startup phase longer than the allowed age stays healthy.
+	time.Sleep(3 * maxAge)
+	if status := healthStatus(health); status != http.StatusOK {
+		t.Fatalf("status during startup = %d, want %d", status, http.StatusOK)
+	}
+
+	// Without measured checks the endpoint fails once the keep alive stops.
+	stopKeepAlive()
+	stopKeepAlive()
+	time.Sleep(2 * maxAge)
+	if status := healthStatus(health); status != http.StatusServiceUnavailable {
+		t.Fatalf("status after startup = %d, want %d", status, http.StatusServiceUnavailable)
+	}
+
+	// A measured check makes it healthy again.
+	health.beat()
+	if status := healthStatus(health); status != http.StatusOK {
+		t.Fatalf("status after a check = %d, want %d", status, http.StatusOK)
+	}
+}
+
+// TestCheckerHealthWaiting checks a wait longer than the allowed age stays
+// healthy until it ends, even when another worker completes a check, and
+// goes stale the allowed age after.
+func TestCheckerHealthWaiting(t *testing.T) {
+	maxAge := 100 * time.Millisecond
+	health := newCheckerHealth(maxAge)
+
+	// A long pacing pause outlasts the allowed age.
+	health.waiting(5 * maxAge)
+	time.Sleep(2 * maxAge)
+	if status := healthStatus(health); status != http.StatusOK {
+		t.Fatalf("status during the wait = %d, want %d", status, http.StatusOK)
+	}
+
+	// A check completing elsewhere does not cut the wait short.
+	health.beat()
+	time.Sleep(2 * maxAge)
+	if status := healthStatus(health); status != http.StatusOK {
+		t.Fatalf("status at the end of the wait = %d, want %d", status, http.StatusOK)
+	}
+
+	// Nothing after the wait makes the checker stale.
+	time.Sleep(3 * maxAge)
+	if status := healthStatus(health); status != http.StatusServiceUnavailable {
+		t.Fatalf("status after the wait = %d, want %d", status, http.StatusServiceUnavailable)
+	}
+}
+
+// TestCheckerHealthDisabled checks a nil tracker is safe to use.
+func TestCheckerHealthDisabled(t *testing.T) {
+	var health *checkerHealth
+	stopKeepAlive := health.keepAlive()
+	health.beat()
+	health.waiting(time.Second)
+	stopKeepAlive()
+}
+
+// healthStatus returns the status /healthz answers with.
+func healthStatus(health *checkerHealth) int {
+	recorder := httptest.NewRecorder()
+	health.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	return recorder.Code
+}
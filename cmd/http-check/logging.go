@@ -0,0 +1,29 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// logFormatText selects logrus's human-readable text output.
+	logFormatText = "text"
+	// logFormatJSON selects one JSON object per log entry.
+	logFormatJSON = "json"
+)
+
+// supportedLogFormats lists the values accepted for LOG_FORMAT.
+var supportedLogFormats = []string{
+	logFormatText,
+	logFormatJSON,
+}
+
+// configureLogging applies the configured log format and level to the global
+// logger.
+func configureLogging(cfg *CheckConfig) {
+	// Switch to JSON output when requested. Text is the logrus default.
+	if cfg.LogFormat == logFormatJSON {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+
+	log.SetLevel(cfg.LogLevel)
+}
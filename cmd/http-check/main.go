@@ -1,70 +1,132 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/kuberhealthy/http-check/pkg/httpcheck"
 	"github.com/kuberhealthy/kuberhealthy/v3/pkg/checkclient"
 	nodecheck "github.com/kuberhealthy/kuberhealthy/v3/pkg/nodecheck"
 	log "github.com/sirupsen/logrus"
 )
 
-// APIRequest describes an HTTP request configuration.
-type APIRequest struct {
-	// URL is the parsed URL for the request.
-	URL *url.URL
-	// Type is the HTTP method to use.
-	Type string
-	// Body is the request body.
-	Body io.Reader
-}
-
 // main wires configuration and executes the HTTP check.
 func main() {
 	// Enable nodecheck debug output for parity with v2.
 	nodecheck.EnableDebugOutput()
 
 	// Parse configuration.
-	cfg, err := parseConfig()
+	cfg, err := parseConfig(os.Args[1:])
 	if err != nil {
-		reportFailureAndExit(err)
+		reportFailureAndExit(nil, nil, err)
+		return
+	}
+	configureLogging(cfg)
+
+	// Show the resolved configuration without running when requested.
+	if cfg.DryRun {
+		logResolvedConfig(cfg)
 		return
 	}
 
-	// Create context for node readiness checks.
-	checkTimeLimit := time.Minute * 1
-	ctx, _ := context.WithTimeout(context.Background(), checkTimeLimit)
+	// Warn loudly when TLS verification is disabled.
+	if cfg.InsecureSkipVerify {
+		log.Warnln("INSECURE_SKIP_VERIFY is enabled: TLS certificates will NOT be verified. Do not use this in production.")
+	}
+
+	// Log the explicit proxy without its credentials.
+	if cfg.ProxyURL != nil {
+		log.Infoln("Routing requests through proxy", cfg.RedactURL(cfg.ProxyURL))
+	}
+
+	// Stop the run when the pod is asked to terminate. A second signal falls
+	// back to the default behavior once stop is called.
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	// Validate URL.
-	parsedURL, err := url.Parse(cfg.CheckURL)
+	// Wait for Kuberhealthy and resolve the hosts before the run. A signal
+	// meanwhile says nothing about the endpoint, like an interrupted run.
+	err = runPreflight(signalCtx, cfg, nodecheck.WaitForKuberhealthy, net.DefaultResolver)
+	if errors.Is(err, httpcheck.ErrInterrupted) {
+		log.Warnln("Not reporting to Kuberhealthy:", err)
+		return
+	}
 	if err != nil {
-		log.Errorln("Cannot parse provided URL:", err.Error())
-		reportFailureAndExit(err)
+		reportFailureAndExit(cfg, nil, err)
 		return
 	}
 
-	// Wait for Kuberhealthy endpoint readiness.
-	err = nodecheck.WaitForKuberhealthy(ctx)
-	if err != nil {
-		log.Errorln("Error waiting for kuberhealthy endpoint to be contactable by checker pod with error:", err.Error())
+	// Calculate passing threshold across every URL.
+	totalChecks := cfg.Count * len(cfg.CheckURLs)
+	passInt := httpcheck.PassingThreshold(cfg.PassingPercent, totalChecks)
+	logHeaderNames(cfg.Headers)
+	logUserAgent(cfg.Config)
+	logCookieNames(cfg.RequestCookies)
+	if cfg.PassOnAnySuccess {
+		log.Warnln("PASS_ON_ANY_SUCCESS is enabled: a single successful check out of", totalChecks, "reports success, overriding MAX_FAILURES and PASSING_PERCENT. This is a deliberately weak health model.")
+	} else if cfg.MaxFailures >= 0 {
+		log.Infoln("Allowing at most", cfg.MaxFailures, "of", totalChecks, "checks to fail across", len(cfg.CheckURLs), "URLs (MAX_FAILURES takes precedence over PASSING_PERCENT)")
+	} else {
+		log.Infoln("Looking for at least", cfg.PassingPercent, "percent of", totalChecks, "checks to pass across", len(cfg.CheckURLs), "URLs (", passInt, "checks, rounded up)")
 	}
 
-	// Calculate passing threshold.
-	passingPercentage := float32(cfg.PassingPercent) / 100
-	passingScore := passingPercentage * float32(cfg.Count)
-	passInt := int(passingScore)
-	log.Infoln("Looking for at least", cfg.PassingPercent, "percent of", cfg.Count, "checks to pass")
+	// Start the metrics and liveness endpoints when configured.
+	var metrics *checkMetrics
+	var metricsServer *http.Server
+	if cfg.MetricsPort != 0 {
+		metrics = newCheckMetrics()
+		metricsServer = startMetricsServer(cfg.MetricsPort, metrics)
+	}
+	var health *checkerHealth
+	var healthServer *http.Server
+	if cfg.HealthPort != 0 {
+		health = newCheckerHealth(time.Duration(cfg.HealthMaxAgeSeconds) * time.Second)
+		healthServer = startHealthServer(cfg.HealthPort, health)
+	}
+	// Keep the heartbeat fresh until the first measured check completes, so
+	// the startup phases are not mistaken for a wedged checker.
+	stopKeepAlive := health.keepAlive()
+	if metrics != nil || health != nil {
+		cfg.OnResult = func(result httpcheck.Result) {
+			metrics.record(result)
+			stopKeepAlive()
+			health.beat()
+		}
+	}
+	// Extend the heartbeat over pacing pauses, retries, and slow requests,
+	// which may legitimately outlast HEALTH_MAX_AGE_SECONDS.
+	if health != nil {
+		cfg.OnWait = health.waiting
+	}
 
 	// Run the configured checks.
-	summary, err := runChecks(cfg, parsedURL)
+	summary, err := httpcheck.Run(signalCtx, cfg.Config)
+	stopKeepAlive()
+	stop()
+	stopMetricsServer(metricsServer)
+	stopHealthServer(healthServer)
+	if cfg.SummaryJSON {
+		printSummaryJSON(cfg, summary, err)
+	}
+	if errors.Is(err, httpcheck.ErrInterrupted) {
+		// A partial run says nothing about the endpoint, so leave the result
+		// to the next scheduled run instead of reporting a failure.
+		log.Warnln("Not reporting to Kuberhealthy:", err, "with", summary.ChecksFailed, "failed")
+		return
+	}
 	if err != nil {
-		reportFailureAndExit(err)
+		reportFailureAndExit(cfg, summary, err)
 		return
 	}
 
@@ -72,125 +134,297 @@ func main() {
 	log.Infoln(summary.ChecksRan, "checks ran")
 	log.Infoln(summary.ChecksPassed, "checks passed")
 	log.Infoln(summary.ChecksFailed, "checks failed")
+	if len(cfg.StatusWeights) != 0 {
+		log.Infoln("Weighted score", summary.Score, "of", float64(cfg.PassingPercent*totalChecks)/100, "required")
+	}
+	if len(cfg.CheckURLs) > 1 {
+		for _, message := range summary.URLFailureMessages() {
+			log.Infoln(message)
+		}
+	}
+	for _, message := range summary.RotatedValueMessages(cfg.RotateHeader) {
+		log.Infoln(message)
+	}
+	if len(summary.StatusCodes) != 0 {
+		log.Infoln(summary.StatusCodeMessage())
+	}
+	if len(summary.ErrorCategories) != 0 {
+		log.Infoln(summary.ErrorCategoryMessage())
+	}
+	if summary.HasLatency() {
+		log.Infoln("Response times: min", summary.MinDuration, "max", summary.MaxDuration, "mean", summary.MeanDuration, "p95", summary.P95Duration, "p99", summary.P99Duration)
+	}
+	if summary.HasTTFB() {
+		log.Infoln("Time to first byte: min", summary.MinTTFB, "max", summary.MaxTTFB, "mean", summary.MeanTTFB, "p95", summary.P95TTFB, "p99", summary.P99TTFB)
+	}
+	if summary.ChecksRan != 0 {
+		checksRan := int64(summary.ChecksRan)
+		log.Infoln("Bytes transferred: sent", summary.RequestBytes, "received", summary.ResponseBytes, "mean sent", summary.RequestBytes/checksRan, "mean received", summary.ResponseBytes/checksRan)
+	}
 
 	// Ensure enough checks passed.
-	if summary.ChecksPassed < passInt {
-		reportErr := fmt.Errorf("unable to retrieve a valid response (expected status: %d) from %s %s checks failed %d out of %d attempts", cfg.ExpectedStatusCode, cfg.RequestType, parsedURL.Redacted(), summary.ChecksFailed, summary.ChecksRan)
-		reportFailureAndExit(reportErr)
+	if !summary.Passed(cfg.Config, totalChecks) {
+		reportErr := fmt.Errorf("unable to retrieve a valid response (expected status: %s) from %s %s checks failed %d out of %d attempts", cfg.ExpectedStatus, cfg.RequestType, redactedURLs(cfg.Config, cfg.CheckURLs), summary.ChecksFailed, summary.ChecksRan)
+		details := summary.FailureMessages()
+		if len(cfg.CheckURLs) > 1 {
+			details = append(summary.URLFailureMessages(), details...)
+		}
+		details = append(summary.RotatedValueMessages(cfg.RotateHeader), details...)
+		if len(summary.StatusCodes) != 0 {
+			details = append(details, summary.StatusCodeMessage())
+		}
+		if len(summary.ErrorCategories) != 0 {
+			details = append(details, summary.ErrorCategoryMessage())
+		}
+		if cfg.PassOnAnySuccess {
+			details = append(details, "no check passed with PASS_ON_ANY_SUCCESS set")
+		} else if cfg.MaxFailures >= 0 {
+			details = append(details, fmt.Sprintf("at most %d failed checks allowed", cfg.MaxFailures))
+		} else if len(cfg.StatusWeights) != 0 {
+			details = append(details, fmt.Sprintf("weighted score %v of %v required", summary.Score, float64(cfg.PassingPercent*totalChecks)/100))
+		}
+		details = append(details, summary.FirstFailureMessages()...)
+		reportFailureAndExit(cfg, summary, reportErr, details...)
 		return
 	}
 
-	// Report success to Kuberhealthy.
-	err = checkclient.ReportSuccess()
+	// Ensure the most recent checks passed.
+	if !summary.TrailingWindowPassed() {
+		reportErr := fmt.Errorf("%d of the last %d checks against %s %s failed", summary.TrailingFailed, summary.TrailingChecks, cfg.RequestType, redactedURLs(cfg.Config, cfg.CheckURLs))
+		details := append(summary.FailureMessages(), summary.FirstFailureMessages()...)
+		reportFailureAndExit(cfg, summary, reportErr, details...)
+		return
+	}
+
+	// Ensure the latency percentiles meet their SLOs.
+	sloFailures := latencySLOFailures(cfg, summary)
+	if len(sloFailures) != 0 {
+		reportErr := fmt.Errorf("%s %s missed its latency SLO: %s", cfg.RequestType, redactedURLs(cfg.Config, cfg.CheckURLs), strings.Join(sloFailures, ", "))
+		reportFailureAndExit(cfg, summary, reportErr)
+		return
+	}
+
+	// Report success to Kuberhealthy. The report carries no details, so the
+	// extracted success value is logged instead.
+	if len(summary.SuccessValue) != 0 {
+		log.WithField("success_value", summary.SuccessValue).Infoln("Healthy with", cfg.SuccessJSONPath, "=", summary.SuccessValue)
+	}
+	err = reportWithTimeout(cfg.ReportTimeoutSeconds, checkclient.ReportSuccess)
 	if err != nil {
 		log.Fatalln("error when reporting to kuberhealthy:", err.Error())
 	}
 	log.Infoln("Successfully reported to Kuberhealthy")
 }
 
-// checkSummary reports the results of a run.
-type checkSummary struct {
-	// ChecksRan is the total number of checks.
-	ChecksRan int
-	// ChecksPassed is the number of successful checks.
-	ChecksPassed int
-	// ChecksFailed is the number of failed checks.
-	ChecksFailed int
-}
+// kuberhealthyWaitLimit bounds the wait for the Kuberhealthy endpoint.
+const kuberhealthyWaitLimit = time.Minute
+
+// runPreflight waits for the Kuberhealthy endpoint with waitForKuberhealthy
+// and, with FAIL_FAST_ON_DNS, resolves every check host with resolver. It
+// returns an error
+// to report when the run should be skipped, or one wrapping
+// httpcheck.ErrInterrupted when signalCtx was cancelled meanwhile.
+func runPreflight(signalCtx context.Context, cfg *CheckConfig, waitForKuberhealthy func(context.Context) error, resolver *net.Resolver) error {
+	// Wait for Kuberhealthy endpoint readiness, giving up before the run
+	// when the endpoint is required.
+	ctx, cancel := context.WithTimeout(signalCtx, kuberhealthyWaitLimit)
+	defer cancel()
+	err := waitForKuberhealthy(ctx)
+	if signalCtx.Err() != nil {
+		return fmt.Errorf("%w while waiting for the kuberhealthy endpoint", httpcheck.ErrInterrupted)
+	}
+	if err != nil && cfg.RequireKHEndpoint {
+		return fmt.Errorf("kuberhealthy endpoint is not reachable and REQUIRE_KH_ENDPOINT is set, skipping the run: %w", err)
+	}
+	if err != nil {
+		log.Errorln("Error waiting for kuberhealthy endpoint to be contactable by checker pod with error:", err.Error())
+	}
+
+	// Resolve each check host once, giving up before the run when one cannot
+	// be resolved and failing fast is requested.
+	if !cfg.FailFastOnDNS {
+		return nil
+	}
+	err = resolveCheckHosts(signalCtx, cfg, resolver)
+	if signalCtx.Err() != nil {
+		return fmt.Errorf("%w while resolving the check hosts", httpcheck.ErrInterrupted)
+	}
+	if err != nil {
+		return fmt.Errorf("%w and FAIL_FAST_ON_DNS is set, skipping the run", err)
+	}
 
-// runChecks executes the request loop and returns a summary.
-func runChecks(cfg *CheckConfig, parsedURL *url.URL) (*checkSummary, error) {
-	// Initialize counters.
-	log.Infoln("Beginning check.")
-	summary := &checkSummary{}
+	return nil
+}
 
-	// Start a ticker if a pause is configured.
-	var ticker *time.Ticker
-	if cfg.Seconds > 0 {
-		ticker = time.NewTicker(time.Duration(cfg.Seconds) * time.Second)
-		defer ticker.Stop()
+// latencySLOFailures describes each latency percentile that exceeded its
+// MAX_P95_MS or MAX_P99_MS limit. Runs without any response have no latency to
+// judge, so they are left to the passing check.
+func latencySLOFailures(cfg *CheckConfig, summary *httpcheck.Summary) []string {
+	// Compare each configured percentile with its limit.
+	failures := []string{}
+	if !summary.HasLatency() {
+		return failures
+	}
+	if cfg.MaxP95Ms > 0 && summary.P95Duration > time.Duration(cfg.MaxP95Ms)*time.Millisecond {
+		failures = append(failures, fmt.Sprintf("p95 %dms exceeds %dms", summary.P95Duration.Milliseconds(), cfg.MaxP95Ms))
+	}
+	if cfg.MaxP99Ms > 0 && summary.P99Duration > time.Duration(cfg.MaxP99Ms)*time.Millisecond {
+		failures = append(failures, fmt.Sprintf("p99 %dms exceeds %dms", summary.P99Duration.Milliseconds(), cfg.MaxP99Ms))
 	}
 
-	// Perform the configured number of requests.
-	for summary.ChecksRan < cfg.Count {
-		response, err := callAPI(APIRequest{
-			URL:  parsedURL,
-			Type: cfg.RequestType,
-			Body: bytes.NewBuffer([]byte(cfg.RequestBody)),
-		})
-		summary.ChecksRan++
+	return failures
+}
 
-		if err != nil {
-			summary.ChecksFailed++
-			log.Errorln("Failed to reach URL:", parsedURL.Redacted())
-			waitForTicker(ticker)
-			continue
-		}
+// dnsPreflightTimeout bounds each host lookup made by resolveCheckHosts.
+const dnsPreflightTimeout = 10 * time.Second
+
+// resolveCheckHosts looks up every CHECK_URL host once with resolver, in the
+// address family IP_VERSION selects. IP literals and HOST_ALIASES hosts need no lookup, and
+// hosts are left to the proxy when PROXY_URL is set.
+func resolveCheckHosts(ctx context.Context, cfg *CheckConfig, resolver *net.Resolver) error {
+	// The proxy resolves the targets itself.
+	if cfg.ProxyURL != nil {
+		log.Infoln("Skipping the FAIL_FAST_ON_DNS lookup because requests go through PROXY_URL")
+		return nil
+	}
+	network := "ip"
+	if cfg.IPVersion != 0 {
+		network += strconv.Itoa(cfg.IPVersion)
+	}
 
-		if response.StatusCode != cfg.ExpectedStatusCode {
-			log.Errorln("Got a", response.StatusCode, "with a", http.MethodGet, "to", parsedURL.Redacted())
-			summary.ChecksFailed++
-			waitForTicker(ticker)
+	// Look up each distinct host.
+	resolved := map[string]bool{}
+	for _, checkURL := range cfg.CheckURLs {
+		host := strings.ToLower(checkURL.Hostname())
+		_, aliased := cfg.HostAliases[host]
+		if resolved[host] || aliased || net.ParseIP(host) != nil {
 			continue
 		}
+		lookupCtx, cancel := context.WithTimeout(ctx, dnsPreflightTimeout)
+		_, err := resolver.LookupIP(lookupCtx, network, host)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("host %s of %s is unresolvable: %w", host, cfg.RedactURL(checkURL), err)
+		}
+		resolved[host] = true
+	}
 
-		log.Infoln("Got a", response.StatusCode, "with a", http.MethodGet, "to", parsedURL.Redacted())
-		summary.ChecksPassed++
+	return nil
+}
 
-		waitForTicker(ticker)
+// logHeaderNames logs which custom headers will be sent without revealing their values.
+func logHeaderNames(headers map[string]string) {
+	// Skip logging when no headers are configured.
+	if len(headers) == 0 {
+		return
 	}
 
-	return summary, nil
+	names := make([]string, 0, len(headers))
+	for key := range headers {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	log.Infoln("Sending custom request headers:", strings.Join(names, ", "))
 }
 
-// waitForTicker blocks until the ticker fires when configured.
-func waitForTicker(ticker *time.Ticker) {
-	// Wait for the next tick when configured.
-	if ticker == nil {
+// logUserAgent logs the User-Agent sent with each request. A User-Agent in the
+// custom headers replaces the configured one, and like every custom header
+// value it is not logged.
+func logUserAgent(cfg *httpcheck.Config) {
+	// Defer to the custom header when one is set.
+	if hasHeader(cfg.Headers, "User-Agent") {
+		log.Infoln("Sending the User-Agent from REQUEST_HEADERS")
 		return
 	}
-	if ticker.C == nil {
+	log.Infoln("Sending User-Agent", cfg.UserAgent)
+}
+
+// logCookieNames logs which static cookies will be sent without revealing their values.
+func logCookieNames(cookies []*http.Cookie) {
+	// Skip logging when no cookies are configured.
+	if len(cookies) == 0 {
 		return
 	}
 
-	<-ticker.C
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	log.Infoln("Sending request cookies:", strings.Join(names, ", "))
 }
 
-// reportFailureAndExit reports an error to Kuberhealthy and exits the program.
-func reportFailureAndExit(err error) {
-	// Log the error and report to Kuberhealthy.
-	log.Errorln(err)
-	reportErr := checkclient.ReportFailure([]string{err.Error()})
-	if reportErr != nil {
-		log.Fatalln("error when reporting to kuberhealthy:", reportErr.Error())
+// redactedURLs renders URLs as a comma-separated list with credentials and
+// sensitive query parameters redacted.
+func redactedURLs(cfg *httpcheck.Config, urls []*url.URL) string {
+	// Redact each URL before joining.
+	redacted := make([]string, 0, len(urls))
+	for _, u := range urls {
+		redacted = append(redacted, cfg.RedactURL(u))
 	}
 
-	os.Exit(0)
+	return strings.Join(redacted, ", ")
 }
 
-// callAPI performs an API call on the basis of the request type, body, and URL.
-func callAPI(request APIRequest) (*http.Response, error) {
-	// Handle GET requests.
-	if request.Type == http.MethodGet {
-		response, err := http.Get(request.URL.String())
-		if err != nil {
-			return nil, fmt.Errorf("error occurred while calling %s: %w", request.URL.Redacted(), err)
-		}
-		return response, nil
+// errReportTimeout is returned when Kuberhealthy does not answer a report
+// within REPORT_TIMEOUT_SECONDS.
+var errReportTimeout = errors.New("kuberhealthy did not answer the report")
+
+// reportWithTimeout runs report, giving up after timeoutSeconds so a hung
+// Kuberhealthy endpoint cannot hold the checker forever. The abandoned report
+// is left running since the process exits right after. Zero waits
+// indefinitely.
+func reportWithTimeout(timeoutSeconds int, report func() error) error {
+	// Report directly when no timeout applies.
+	if timeoutSeconds == 0 {
+		return report()
 	}
 
-	// Handle other request types.
-	if request.Type == http.MethodPost || request.Type == http.MethodPut || request.Type == http.MethodDelete || request.Type == http.MethodPatch {
-		req, err := http.NewRequest(request.Type, request.URL.String(), request.Body)
-		if err != nil {
-			return nil, fmt.Errorf("error occurred while calling %s: %w", request.URL.Redacted(), err)
-		}
-		response, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("error occurred while calling %s: %w", request.URL.Redacted(), err)
-		}
-		return response, nil
+	// Race the report against the timeout.
+	done := make(chan error, 1)
+	go func() {
+		done <- report()
+	}()
+	timer := time.NewTimer(time.Duration(timeoutSeconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w within %d seconds", errReportTimeout, timeoutSeconds)
+	}
+}
+
+// reportFailureAndExit reports an error to Kuberhealthy and exits the program
+// with cfg.ExitCodeOnFailure. Any details are reported as additional error
+// messages after err. The config and summary are nil when the failure happened
+// before the run, in which case the webhook is skipped and the exit code is
+// read from whatever configuration could still be loaded.
+func reportFailureAndExit(cfg *CheckConfig, summary *httpcheck.Summary, err error, details ...string) {
+	// Log the error and notify the webhook, which bounds its own time so it
+	// cannot hold up the report.
+	log.Errorln(err)
+	if cfg != nil && cfg.NotifyWebhookURL != nil {
+		notifyWebhook(cfg.NotifyWebhookURL, newFailureNotification(cfg, summary, err))
 	}
 
-	return nil, fmt.Errorf("error occurred while calling %s: wrong request type found", request.URL.Redacted())
+	// Report to Kuberhealthy, using the default timeout when the config could
+	// not be parsed.
+	errorMessages := append([]string{err.Error()}, details...)
+	reportTimeout := defaultReportTimeoutSeconds
+	if cfg != nil {
+		reportTimeout = cfg.ReportTimeoutSeconds
+	}
+	reportErr := reportWithTimeout(reportTimeout, func() error {
+		return checkclient.ReportFailure(errorMessages)
+	})
+	if reportErr != nil {
+		log.Fatalln("error when reporting to kuberhealthy:", reportErr.Error())
+	}
+
+	// Exit only after the report so the exit code never suppresses it.
+	exitCode := failureExitCode(os.Args[1:])
+	if cfg != nil {
+		exitCode = cfg.ExitCodeOnFailure
+	}
+	os.Exit(exitCode)
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kuberhealthy/http-check/pkg/httpcheck"
+)
+
+// TestRunPreflight checks a signal while waiting for Kuberhealthy or while
+// resolving the check hosts is reported as an interruption rather than as a
+// failure.
+func TestRunPreflight(t *testing.T) {
+	errUnreachable := errors.New("connection refused")
+	tests := []struct {
+		name              string
+		host              string
+		requireKHEndpoint bool
+		failFastOnDNS     bool
+		// signalDuringWait cancels the signal context while waiting for
+		// Kuberhealthy.
+		signalDuringWait bool
+		// waitErr is returned by the Kuberhealthy wait.
+		waitErr error
+		// signalDuringLookup cancels the signal context while a host is being
+		// resolved. Otherwise every DNS query fails.
+		signalDuringLookup bool
+		wantErr            string
+		wantInterrupted    bool
+	}{
+		{name: "reachable", host: "example.invalid"},
+		{name: "unreachable and optional", host: "example.invalid", waitErr: errUnreachable},
+		{name: "unreachable and required", host: "example.invalid", requireKHEndpoint: true, waitErr: errUnreachable, wantErr: "REQUIRE_KH_ENDPOINT is set"},
+		{name: "signal while waiting", host: "example.invalid", requireKHEndpoint: true, signalDuringWait: true, wantInterrupted: true},
+		{name: "signal while waiting and optional", host: "example.invalid", signalDuringWait: true, wantInterrupted: true},
+		{name: "unresolvable host", host: "example.invalid", failFastOnDNS: true, wantErr: "FAIL_FAST_ON_DNS is set"},
+		{name: "unresolvable host without fail fast", host: "example.invalid"},
+		{name: "IP literal", host: "127.0.0.1", failFastOnDNS: true},
+		{name: "signal while resolving", host: "example.invalid", failFastOnDNS: true, signalDuringLookup: true, wantInterrupted: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signalCtx, signal := context.WithCancel(context.Background())
+			defer signal()
+			cfg := &CheckConfig{Config: httpcheck.NewConfig()}
+			cfg.CheckURLs = []*url.URL{{Scheme: "https", Host: test.host}}
+			cfg.RequireKHEndpoint = test.requireKHEndpoint
+			cfg.FailFastOnDNS = test.failFastOnDNS
+
+			// Stand in for Kuberhealthy and the DNS server.
+			wait := func(ctx context.Context) error {
+				if test.signalDuringWait {
+					signal()
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return test.waitErr
+			}
+			resolver := &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+					if test.signalDuringLookup {
+						signal()
+						<-ctx.Done()
+						return nil, ctx.Err()
+					}
+					return nil, errors.New("no DNS server in tests")
+				},
+			}
+
+			err := runPreflight(signalCtx, cfg, wait, resolver)
+			if errors.Is(err, httpcheck.ErrInterrupted) != test.wantInterrupted {
+				t.Fatalf("runPreflight error = %v, want interrupted = %v", err, test.wantInterrupted)
+			}
+			if test.wantInterrupted {
+				return
+			}
+			if len(test.wantErr) == 0 && err != nil {
+				t.Fatalf("runPreflight returned an error: %v", err)
+			}
+			if len(test.wantErr) != 0 && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("runPreflight error = %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kuberhealthy/http-check/pkg/httpcheck"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// metricsShutdownTimeout bounds how long the metrics server may take to stop.
+const metricsShutdownTimeout = 5 * time.Second
+
+// checkMetrics holds the Prometheus collectors updated during a run.
+type checkMetrics struct {
+	// registry holds only the check collectors.
+	registry *prometheus.Registry
+	// checksRan counts every check performed.
+	checksRan prometheus.Counter
+	// checksPassed counts successful checks.
+	checksPassed prometheus.Counter
+	// checksFailed counts failed checks.
+	checksFailed prometheus.Counter
+	// responseTime observes the response time of requests that got a response.
+	responseTime prometheus.Histogram
+}
+
+// newCheckMetrics creates and registers the check collectors.
+func newCheckMetrics() *checkMetrics {
+	// Create the collectors.
+	m := &checkMetrics{
+		registry: prometheus.NewRegistry(),
+		checksRan: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "http_check_checks_ran_total",
+			Help: "Total number of HTTP checks performed.",
+		}),
+		checksPassed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "http_check_checks_passed_total",
+			Help: "Total number of HTTP checks that passed.",
+		}),
+		checksFailed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "http_check_checks_failed_total",
+			Help: "Total number of HTTP checks that failed.",
+		}),
+		responseTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "http_check_response_time_seconds",
+			Help:    "Response time of HTTP check requests that received a response.",
+			Buckets: prometheus.DefBuckets,
+		}),
+	}
+
+	// Register the collectors on a dedicated registry.
+	m.registry.MustRegister(m.checksRan, m.checksPassed, m.checksFailed, m.responseTime)
+	return m
+}
+
+// record updates the collectors with the outcome of a single request. It is a
+// no-op on a nil receiver so callers do not need to check whether metrics are
+// enabled.
+func (m *checkMetrics) record(result httpcheck.Result) {
+	// Skip when metrics are disabled.
+	if m == nil {
+		return
+	}
+
+	m.checksRan.Inc()
+	if result.Err != nil {
+		m.checksFailed.Inc()
+	} else {
+		m.checksPassed.Inc()
+	}
+	if result.StatusCode != 0 {
+		m.responseTime.Observe(result.Duration.Seconds())
+	}
+}
+
+// startMetricsServer serves the check collectors on /metrics at port.
+func startMetricsServer(port int, m *checkMetrics) *http.Server {
+	// Expose only the check registry.
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Serve in the background.
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorln("Metrics server stopped with error:", err)
+		}
+	}()
+	log.Infoln("Serving metrics on port", port)
+
+	return server
+}
+
+// stopMetricsServer gracefully shuts down the metrics server when it is running.
+func stopMetricsServer(server *http.Server) {
+	// Skip when metrics are disabled.
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if err != nil {
+		log.Errorln("Error shutting down metrics server:", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kuberhealthy/http-check/pkg/httpcheck"
+	log "github.com/sirupsen/logrus"
+)
+
+// webhookTimeout bounds the failure webhook call so a slow receiver cannot
+// delay the Kuberhealthy report.
+const webhookTimeout = 5 * time.Second
+
+// failureNotification is the JSON payload posted to NOTIFY_WEBHOOK_URL.
+type failureNotification struct {
+	// URLs are the redacted check URLs.
+	URLs []string `json:"urls"`
+	// ChecksRan is the number of checks performed.
+	ChecksRan int `json:"checksRan"`
+	// ChecksFailed is the number of failed checks.
+	ChecksFailed int `json:"checksFailed"`
+	// Error is the failure reported to Kuberhealthy.
+	Error string `json:"error"`
+	// SampleError is the error of the first failed check, when one ran.
+	SampleError string `json:"sampleError,omitempty"`
+}
+
+// newFailureNotification builds the webhook payload for a failed run. The
+// summary is nil when the run never started.
+func newFailureNotification(cfg *CheckConfig, summary *httpcheck.Summary, err error) failureNotification {
+	// Describe the run without revealing credentials.
+	notification := failureNotification{Error: err.Error()}
+	for _, u := range cfg.CheckURLs {
+		notification.URLs = append(notification.URLs, cfg.RedactURL(u))
+	}
+	if summary == nil {
+		return notification
+	}
+	notification.ChecksRan = summary.ChecksRan
+	notification.ChecksFailed = summary.ChecksFailed
+	if summary.FirstFailure != nil {
+		notification.SampleError = summary.FirstFailure.Err.Error()
+	}
+
+	return notification
+}
+
+// notifyWebhook posts notification to webhookURL. Failures are logged and
+// otherwise ignored so the Kuberhealthy report always goes out.
+func notifyWebhook(webhookURL *url.URL, notification failureNotification) {
+	// Encode the payload.
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		log.Warnln("Not sending failure webhook:", err)
+		return
+	}
+
+	// Post it within the webhook timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	err = postWebhook(ctx, webhookURL, payload)
+	if err != nil {
+		log.Warnln("Failure webhook was not delivered:", err)
+		return
+	}
+	log.Infoln("Sent failure webhook")
+}
+
+// postWebhook sends payload to webhookURL and checks for a 2xx response. The
+// returned error never includes the URL, since webhook URLs often carry a
+// secret token in their path.
+func postWebhook(ctx context.Context, webhookURL *url.URL, payload []byte) error {
+	// Build the request.
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL.String(), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	// Send it, dropping the URL from transport errors.
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error calling webhook: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", response.StatusCode)
+	}
+
+	return nil
+}
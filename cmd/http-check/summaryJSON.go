@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/kuberhealthy/http-check/pkg/httpcheck"
+	log "github.com/sirupsen/logrus"
+)
+
+// summaryReport is the machine-readable run summary printed when SUMMARY_JSON
+// is set.
+type summaryReport struct {
+	// ChecksRan is the number of checks performed.
+	ChecksRan int `json:"checksRan"`
+	// ChecksPassed is the number of successful checks.
+	ChecksPassed int `json:"checksPassed"`
+	// ChecksFailed is the number of failed checks.
+	ChecksFailed int `json:"checksFailed"`
+	// Score is the weighted score of the run.
+	Score float64 `json:"score"`
+	// Passed reports whether the run met PASSING_PERCENT, or MAX_FAILURES,
+	// the trailing window, and the latency SLOs.
+	Passed bool `json:"passed"`
+	// SuccessValue is the value extracted at SUCCESS_JSON_PATH, when one was.
+	SuccessValue string `json:"successValue,omitempty"`
+	// RequestBytes is the total size of the request bodies sent.
+	RequestBytes int64 `json:"requestBytes"`
+	// ResponseBytes is the total number of response body bytes read.
+	ResponseBytes int64 `json:"responseBytes"`
+	// RunError is the error that ended the run early, when one did.
+	RunError string `json:"runError,omitempty"`
+	// LatencyMs holds the response time statistics, when any request got a
+	// response.
+	LatencyMs *latencyReport `json:"latencyMs,omitempty"`
+	// TTFBMs holds the time to first byte statistics, when any were recorded.
+	TTFBMs *latencyReport `json:"ttfbMs,omitempty"`
+	// StatusCodes counts the responses received with each status code.
+	StatusCodes map[int]int `json:"statusCodes"`
+	// ErrorCategories counts the requests that got no response, or a refused
+	// WebSocket upgrade, by the kind of failure.
+	ErrorCategories map[httpcheck.ErrorCategory]int `json:"errorCategories"`
+	// Errors lists each distinct failure with its count, most common first.
+	Errors []errorReport `json:"errors"`
+	// URLs holds the per-URL counts, sorted by URL.
+	URLs []urlReport `json:"urls"`
+}
+
+// latencyReport holds response time statistics in milliseconds.
+type latencyReport struct {
+	// Min is the fastest response time.
+	Min int64 `json:"min"`
+	// Max is the slowest response time.
+	Max int64 `json:"max"`
+	// Mean is the average response time.
+	Mean int64 `json:"mean"`
+	// P95 is the 95th percentile response time.
+	P95 int64 `json:"p95"`
+	// P99 is the 99th percentile response time.
+	P99 int64 `json:"p99"`
+}
+
+// errorReport counts one distinct failure message.
+type errorReport struct {
+	// Message is the failure message.
+	Message string `json:"message"`
+	// Count is how many checks failed with it.
+	Count int `json:"count"`
+}
+
+// urlReport holds the check counts for one redacted URL.
+type urlReport struct {
+	// URL is the redacted URL.
+	URL string `json:"url"`
+	// ChecksRan is the number of checks against the URL.
+	ChecksRan int `json:"checksRan"`
+	// ChecksFailed is the number of failed checks against the URL.
+	ChecksFailed int `json:"checksFailed"`
+}
+
+// newSummaryReport builds the JSON summary of a run. runErr is the error Run
+// returned, if any.
+func newSummaryReport(cfg *CheckConfig, summary *httpcheck.Summary, runErr error) summaryReport {
+	// Copy the counts.
+	totalChecks := cfg.Count * len(cfg.CheckURLs)
+	report := summaryReport{
+		ChecksRan:       summary.ChecksRan,
+		ChecksPassed:    summary.ChecksPassed,
+		ChecksFailed:    summary.ChecksFailed,
+		Score:           summary.Score,
+		Passed:          runErr == nil && summary.Passed(cfg.Config, totalChecks) && summary.TrailingWindowPassed() && len(latencySLOFailures(cfg, summary)) == 0,
+		StatusCodes:     summary.StatusCodes,
+		ErrorCategories: summary.ErrorCategories,
+		SuccessValue:    summary.SuccessValue,
+		RequestBytes:    summary.RequestBytes,
+		ResponseBytes:   summary.ResponseBytes,
+		Errors:          []errorReport{},
+		URLs:            []urlReport{},
+	}
+	if runErr != nil {
+		report.RunError = runErr.Error()
+	}
+	if report.StatusCodes == nil {
+		report.StatusCodes = map[int]int{}
+	}
+	if report.ErrorCategories == nil {
+		report.ErrorCategories = map[httpcheck.ErrorCategory]int{}
+	}
+
+	// Add the latency statistics when any request got a response.
+	if summary.HasLatency() {
+		report.LatencyMs = &latencyReport{
+			Min:  summary.MinDuration.Milliseconds(),
+			Max:  summary.MaxDuration.Milliseconds(),
+			Mean: summary.MeanDuration.Milliseconds(),
+			P95:  summary.P95Duration.Milliseconds(),
+			P99:  summary.P99Duration.Milliseconds(),
+		}
+	}
+	if summary.HasTTFB() {
+		report.TTFBMs = &latencyReport{
+			Min:  summary.MinTTFB.Milliseconds(),
+			Max:  summary.MaxTTFB.Milliseconds(),
+			Mean: summary.MeanTTFB.Milliseconds(),
+			P95:  summary.P95TTFB.Milliseconds(),
+			P99:  summary.P99TTFB.Milliseconds(),
+		}
+	}
+
+	// List the errors, most common first, and the URLs in a stable order.
+	for message, count := range summary.FailureReasons {
+		report.Errors = append(report.Errors, errorReport{Message: message, Count: count})
+	}
+	sort.Slice(report.Errors, func(i, j int) bool {
+		if report.Errors[i].Count != report.Errors[j].Count {
+			return report.Errors[i].Count > report.Errors[j].Count
+		}
+		return report.Errors[i].Message < report.Errors[j].Message
+	})
+	for redactedURL, perURL := range summary.URLResults {
+		report.URLs = append(report.URLs, urlReport{URL: redactedURL, ChecksRan: perURL.ChecksRan, ChecksFailed: perURL.ChecksFailed})
+	}
+	sort.Slice(report.URLs, func(i, j int) bool { return report.URLs[i].URL < report.URLs[j].URL })
+
+	return report
+}
+
+// printSummaryJSON writes the JSON summary of a run to stdout as one line, so
+// it stays separate from the log output on stderr.
+func printSummaryJSON(cfg *CheckConfig, summary *httpcheck.Summary, runErr error) {
+	// Encode and print the report.
+	encoded, err := json.Marshal(newSummaryReport(cfg, summary, runErr))
+	if err != nil {
+		log.Warnln("error encoding the JSON summary:", err)
+		return
+	}
+	fmt.Fprintln(os.Stdout, string(encoded))
+}
@@ -0,0 +1,87 @@
+package httpcheck
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// BodyTemplateData holds the values a request body template can use.
+type BodyTemplateData struct {
+	// Timestamp is the time the request was built, in RFC 3339 format.
+	Timestamp string
+	// Unix is the time the request was built, in seconds since the epoch.
+	Unix int64
+	// Iteration is the 1-based number of the measured request in the run.
+	// Warm-up requests use 0.
+	Iteration int
+	// UUID is a random version 4 UUID, unique to the request.
+	UUID string
+}
+
+// ParseBodyTemplate parses body as a text/template when it contains an action
+// such as {{.Timestamp}}, and returns nil for a plain body. The template is
+// rendered once with sample values so references to unknown fields fail here
+// rather than on every request.
+func ParseBodyTemplate(body string) (*template.Template, error) {
+	// Leave plain bodies alone.
+	if !strings.Contains(body, "{{") {
+		return nil, nil
+	}
+
+	// Parse and trial-render the template.
+	bodyTemplate, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	err = bodyTemplate.Execute(&bytes.Buffer{}, newBodyTemplateData(1))
+	if err != nil {
+		return nil, err
+	}
+
+	return bodyTemplate, nil
+}
+
+// requestBody returns the body for a request, rendering cfg.RequestBodyTemplate
+// when one is set.
+func requestBody(cfg *Config, iteration int) ([]byte, error) {
+	// Send the static body when there is no template.
+	if cfg.RequestBodyTemplate == nil {
+		return []byte(cfg.RequestBody), nil
+	}
+
+	// Render the template with fresh values.
+	var rendered bytes.Buffer
+	err := cfg.RequestBodyTemplate.Execute(&rendered, newBodyTemplateData(iteration))
+	if err != nil {
+		return nil, fmt.Errorf("error rendering request body: %w", err)
+	}
+
+	return rendered.Bytes(), nil
+}
+
+// newBodyTemplateData returns the template values for one request.
+func newBodyTemplateData(iteration int) BodyTemplateData {
+	// Capture the time once so both forms agree.
+	now := time.Now()
+	return BodyTemplateData{
+		Timestamp: now.UTC().Format(time.RFC3339),
+		Unix:      now.Unix(),
+		Iteration: iteration,
+		UUID:      newUUID(),
+	}
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	// Set the version and variant bits on 16 random bytes.
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
@@ -0,0 +1,52 @@
+package httpcheck
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// cacheBustParam is the query parameter added to every request when
+// CacheBust is enabled.
+const cacheBustParam = "_cb"
+
+// cacheBustCounter keeps cache-busting values unique when concurrent requests
+// start within the same clock tick.
+var cacheBustCounter atomic.Uint64
+
+// cacheBustURL returns a copy of u with a unique cacheBustParam appended. The
+// existing query string is kept byte for byte.
+func cacheBustURL(u *url.URL) *url.URL {
+	// Combine the clock with a counter so every value differs.
+	value := strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(cacheBustCounter.Add(1), 36)
+
+	// Append rather than re-encode so existing parameters are untouched.
+	busted := *u
+	if len(busted.RawQuery) != 0 {
+		busted.RawQuery += "&"
+	}
+	busted.RawQuery += cacheBustParam + "=" + value
+
+	return &busted
+}
+
+// stripCacheBust returns a copy of u without any cacheBustParam, so a URL the
+// request landed on can be compared with the configured one. The other
+// parameters are kept byte for byte.
+func stripCacheBust(u *url.URL) *url.URL {
+	// Drop only the cache-busting pairs.
+	stripped := *u
+	pairs := strings.Split(stripped.RawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		if key != cacheBustParam {
+			kept = append(kept, pair)
+		}
+	}
+	stripped.RawQuery = strings.Join(kept, "&")
+
+	return &stripped
+}
@@ -0,0 +1,203 @@
+package httpcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// newHTTPClient builds the HTTP client used for every check request.
+func newHTTPClient(cfg *Config) *http.Client {
+	// Start from the default transport so dial settings are kept.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = newTLSConfig(cfg)
+
+	// Route through the explicit proxy, falling back to the proxy environment.
+	transport.Proxy = http.ProxyFromEnvironment
+	if cfg.ProxyURL != nil {
+		transport.Proxy = http.ProxyURL(cfg.ProxyURL)
+	}
+	if cfg.RequireHTTP2 {
+		transport.ForceAttemptHTTP2 = true
+	}
+
+	// Speak only HTTP/2 for gRPC, without TLS for http URLs.
+	if cfg.Protocol == ProtocolGRPC {
+		transport.Protocols = &http.Protocols{}
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	// Upgrades to WebSocket are only defined for HTTP/1.1. The client timeout
+	// would hide the writable upgraded connection behind a read-only body, so
+	// the handshake is bounded by the response header timeout instead and the
+	// ping exchange bounds itself.
+	timeout := time.Duration(cfg.RequestTimeout) * time.Second
+	if cfg.Protocol == ProtocolWebSocket {
+		transport.Protocols = &http.Protocols{}
+		transport.Protocols.SetHTTP1(true)
+		transport.ResponseHeaderTimeout = timeout
+		timeout = 0
+	}
+
+	// Pin connections to one address family, bound the dial, and apply host
+	// aliases when configured.
+	if cfg.IPVersion != 0 || cfg.DialTimeoutMs > 0 || len(cfg.HostAliases) != 0 {
+		transport.DialContext = newDialer(cfg)
+	}
+
+	// Bound the response headers when configured.
+	if cfg.MaxResponseHeaderBytes > 0 {
+		transport.MaxResponseHeaderBytes = cfg.MaxResponseHeaderBytes
+	}
+
+	// Apply the connection reuse policy.
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	}
+
+	// Bound each request by the configured timeout.
+	return &http.Client{
+		Transport:     transport,
+		Timeout:       timeout,
+		CheckRedirect: newRedirectPolicy(cfg),
+	}
+}
+
+// defaultDialTimeout matches the dial timeout of http.DefaultTransport.
+const defaultDialTimeout = 30 * time.Second
+
+// newDialer returns a dial function that honors DialTimeoutMs and
+// HostAliases and, when IPVersion is set, only connects over IPv4 or IPv6 so
+// a broken path for one family is not masked by falling back to the other.
+// Other settings match http.DefaultTransport.
+func newDialer(cfg *Config) func(context.Context, string, string) (net.Conn, error) {
+	// Bound the connection attempt separately from the request.
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout(cfg),
+		KeepAlive: 30 * time.Second,
+	}
+
+	// Restrict tcp to tcp4 or tcp6 and dial aliased hosts by address.
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		if network == "tcp" && cfg.IPVersion != 0 {
+			network += strconv.Itoa(cfg.IPVersion)
+		}
+		return dialer.DialContext(ctx, network, aliasAddress(cfg, address))
+	}
+}
+
+// aliasAddress replaces the host in a host:port dial address with its
+// HostAliases entry, keeping the port. Other addresses are returned as is.
+func aliasAddress(cfg *Config, address string) string {
+	// Look up the host without its port.
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	ip, ok := cfg.HostAliases[strings.ToLower(host)]
+	if !ok {
+		return address
+	}
+
+	return net.JoinHostPort(ip, port)
+}
+
+// errTooManyRedirects is returned when a request exceeds MAX_REDIRECTS.
+var errTooManyRedirects = errors.New("too many redirects")
+
+// newRedirectPolicy builds the client's redirect policy. A nil policy keeps
+// Go's default of following up to 10 redirects.
+func newRedirectPolicy(cfg *Config) func(*http.Request, []*http.Request) error {
+	// Return the redirect response itself when redirects are disabled.
+	if !cfg.FollowRedirects {
+		return func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	// Enforce the configured redirect cap.
+	if cfg.MaxRedirects > 0 {
+		return func(_ *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("%w: stopped after %d redirects", errTooManyRedirects, cfg.MaxRedirects)
+			}
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// newTLSConfig builds the TLS settings for the check transport.
+func newTLSConfig(cfg *Config) *tls.Config {
+	// Refuse old TLS versions in the handshake unless they are asserted on
+	// the response instead.
+	var minVersion uint16
+	if !cfg.AssertMinTLSVersion {
+		minVersion = cfg.MinTLSVersion
+	}
+
+	// Apply the configured verification policy, trusted roots, and client
+	// certificates. A nil RootCAs falls back to the system roots.
+	return &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		RootCAs:            cfg.RootCAs,
+		Certificates:       cfg.ClientCertificates,
+		MinVersion:         minVersion,
+		ServerName:         serverName(cfg.HostOverride),
+	}
+}
+
+// serverName returns the TLS server name for a Host override, dropping any
+// port. An empty override keeps the name from the request URL.
+func serverName(host string) string {
+	// Strip the port when one is present.
+	name, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+
+	return name
+}
+
+// dialTimeout returns the time allowed for each connection attempt.
+func dialTimeout(cfg *Config) time.Duration {
+	// Fall back to the transport default.
+	if cfg.DialTimeoutMs > 0 {
+		return time.Duration(cfg.DialTimeoutMs) * time.Millisecond
+	}
+
+	return defaultDialTimeout
+}
+
+// isDialTimeout reports whether err was caused by a connection attempt that
+// timed out.
+func isDialTimeout(err error) bool {
+	// Look for a dial error that flags itself as a timeout.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial" && opErr.Timeout()
+	}
+
+	return false
+}
+
+// isTimeout reports whether err was caused by a request timeout.
+func isTimeout(err error) bool {
+	// Look for a network error that flags itself as a timeout.
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+
+	return false
+}
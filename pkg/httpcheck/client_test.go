@@ -0,0 +1,219 @@
+package httpcheck
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newClientCertificate issues a client certificate signed by a fresh CA and
+// returns it with a pool that trusts the CA.
+func newClientCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	// Create the CA.
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating the CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("error creating the CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("error parsing the CA certificate: %v", err)
+	}
+
+	// Issue the client certificate from the CA.
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating the client key: %v", err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "http-check"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("error creating the client certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}, pool
+}
+
+// TestClientCertificates checks a server that requires client auth only
+// passes when the client certificate is configured.
+func TestClientCertificates(t *testing.T) {
+	// Require a certificate signed by the test CA.
+	clientCert, clientCAs := newClientCertificate(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+	serverCAs := x509.NewCertPool()
+	serverCAs.AddCert(server.Certificate())
+
+	tests := []struct {
+		name         string
+		certificates []tls.Certificate
+		wantPass     bool
+	}{
+		{name: "with certificate", certificates: []tls.Certificate{clientCert}, wantPass: true},
+		{name: "without certificate", wantPass: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newTestConfig(t, server.URL)
+			cfg.RootCAs = serverCAs
+			cfg.ClientCertificates = test.certificates
+			summary := runTestConfig(t, cfg)
+			if summary.Passed(cfg, cfg.Count) != test.wantPass {
+				t.Errorf("passed = %v, want %v, failures: %v", !test.wantPass, test.wantPass, summary.FailureMessages())
+			}
+		})
+	}
+}
+
+// TestProxyURL checks requests are sent through ProxyURL when it is set.
+func TestProxyURL(t *testing.T) {
+	// Answer every proxied request, recording where it was headed.
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		name        string
+		proxyURL    string
+		wantPass    bool
+		wantProxied int
+	}{
+		{name: "with proxy", proxyURL: proxy.URL, wantPass: true, wantProxied: 2},
+		{name: "without proxy", wantPass: false, wantProxied: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mu.Lock()
+			proxied = nil
+			mu.Unlock()
+
+			// The target only resolves through the proxy.
+			cfg := newTestConfig(t, "http://target.invalid/healthz")
+			cfg.Count = 2
+			if len(test.proxyURL) != 0 {
+				cfg.ProxyURL = mustParseURL(t, test.proxyURL)
+			}
+			summary := runTestConfig(t, cfg)
+			if summary.Passed(cfg, cfg.Count) != test.wantPass {
+				t.Errorf("passed = %v, want %v, failures: %v", !test.wantPass, test.wantPass, summary.FailureMessages())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(proxied) != test.wantProxied {
+				t.Fatalf("proxy received %d requests, want %d", len(proxied), test.wantProxied)
+			}
+			for _, target := range proxied {
+				if target != "http://target.invalid/healthz" {
+					t.Errorf("proxy was asked for %s, want http://target.invalid/healthz", target)
+				}
+			}
+		})
+	}
+}
+
+// TestRedirectPolicy checks redirects are followed by default, returned as is
+// when disabled, and capped by MaxRedirects without being retried.
+func TestRedirectPolicy(t *testing.T) {
+	// Redirect /hop/N to /hop/N-1 until /hop/0 answers.
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		hops, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+		if err != nil || hops == 0 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, "/hop/"+strconv.Itoa(hops-1), http.StatusFound)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		hops            int
+		followRedirects bool
+		maxRedirects    int
+		retries         int
+		expectedStatus  int
+		wantPass        bool
+		wantRequests    int64
+		wantCategory    ErrorCategory
+	}{
+		{name: "followed", hops: 3, followRedirects: true, wantPass: true, wantRequests: 4},
+		{name: "not followed", hops: 3, followRedirects: false, wantPass: false, wantRequests: 1},
+		{name: "not followed and expected", hops: 3, followRedirects: false, expectedStatus: http.StatusFound, wantPass: true, wantRequests: 1},
+		{name: "within the cap", hops: 3, followRedirects: true, maxRedirects: 3, wantPass: true, wantRequests: 4},
+		{name: "over the cap is not retried", hops: 3, followRedirects: true, maxRedirects: 2, retries: 2, wantPass: false, wantRequests: 3, wantCategory: CategoryRedirect},
+		{name: "over the default limit", hops: 11, followRedirects: true, wantPass: false, wantRequests: 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests.Store(0)
+			cfg := newTestConfig(t, server.URL+"/hop/"+strconv.Itoa(test.hops))
+			cfg.FollowRedirects = test.followRedirects
+			cfg.MaxRedirects = test.maxRedirects
+			cfg.Retries = test.retries
+			if test.expectedStatus != 0 {
+				cfg.ExpectedStatus = NewStatusMatcher(test.expectedStatus)
+			}
+			summary := runTestConfig(t, cfg)
+			if summary.Passed(cfg, cfg.Count) != test.wantPass {
+				t.Errorf("passed = %v, want %v, failures: %v", !test.wantPass, test.wantPass, summary.FailureMessages())
+			}
+			if requests.Load() != test.wantRequests {
+				t.Errorf("server got %d requests, want %d", requests.Load(), test.wantRequests)
+			}
+			if len(test.wantCategory) != 0 && summary.ErrorCategories[test.wantCategory] != 1 {
+				t.Errorf("error categories = %v, want one %s", summary.ErrorCategories, test.wantCategory)
+			}
+		})
+	}
+}
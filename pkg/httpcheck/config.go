@@ -0,0 +1,388 @@
+package httpcheck
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"text/template"
+	"time"
+)
+
+const (
+	// DefaultCount is the number of requests sent to each URL.
+	DefaultCount = 1
+	// DefaultPassingPercent is the percent of requests that must succeed.
+	DefaultPassingPercent = 100
+	// DefaultMaxFailures leaves the pass decision to PassingPercent.
+	DefaultMaxFailures = -1
+	// DefaultRequestType is the HTTP method used for requests.
+	DefaultRequestType = "GET"
+	// DefaultExpectedStatusCode is the status code that counts as a success.
+	DefaultExpectedStatusCode = 200
+	// DefaultRequestTimeout is the per-request timeout in seconds.
+	DefaultRequestTimeout = 30
+	// DefaultConcurrency is the number of workers sending requests.
+	DefaultConcurrency = 1
+	// DefaultRetryBackoffMs is the delay before the first retry.
+	DefaultRetryBackoffMs = 500
+	// DefaultMaxRetryAfterSeconds caps how long a Retry-After header can delay
+	// a retry.
+	DefaultMaxRetryAfterSeconds = 30
+	// DefaultRequestContentType is the Content-Type sent with a request body.
+	DefaultRequestContentType = "application/json"
+	// ProtocolHTTP checks URLs with plain HTTP requests.
+	ProtocolHTTP = "http"
+	// ProtocolGRPC checks URLs with the gRPC health checking protocol.
+	ProtocolGRPC = "grpc"
+	// ProtocolWebSocket checks that URLs accept a WebSocket upgrade.
+	ProtocolWebSocket = "websocket"
+	// IdempotencyStatus repeats each check request and requires the same
+	// status code.
+	IdempotencyStatus = "status"
+	// IdempotencyBody repeats each check request and requires the same status
+	// code and body.
+	IdempotencyBody = "body"
+	// DefaultMaxBodyBytes is how much of a response body is read for
+	// assertions.
+	DefaultMaxBodyBytes = 1 << 20
+)
+
+// Version is the release of the check reported in DefaultUserAgent. Release
+// builds set it with
+// -ldflags "-X github.com/kuberhealthy/http-check/pkg/httpcheck.Version=v1.2.3".
+var Version = "dev"
+
+// DefaultUserAgent identifies the check and its version to the servers it
+// queries.
+var DefaultUserAgent = "kuberhealthy-http-check/" + Version
+
+// Config stores configuration for the HTTP check.
+type Config struct {
+	// CheckURLs are the URLs to query.
+	CheckURLs []*url.URL
+	// Count is the number of requests to perform.
+	Count int
+	// Seconds is the pause between requests.
+	Seconds int
+	// PassingPercent is the percent of successful responses required.
+	PassingPercent int
+	// MaxFailures is how many checks may fail before the run fails. When zero
+	// or more it replaces PassingPercent. A negative value disables it.
+	MaxFailures int
+	// RequestType is the HTTP method to use.
+	RequestType string
+	// RequestBody is the body payload for non-GET requests.
+	RequestBody string
+	// RequestBodyTemplate renders the body of each request in place of
+	// RequestBody when set. See ParseBodyTemplate.
+	RequestBodyTemplate *template.Template
+	// AllowEmptyBody lets POST, PUT, and PATCH requests be sent without a
+	// RequestBody. See Validate.
+	AllowEmptyBody bool
+	// ExpectedStatus decides which HTTP status codes count as a success.
+	ExpectedStatus *StatusMatcher
+	// RequestTimeout is the per-request timeout in seconds.
+	RequestTimeout int
+	// Headers are extra request headers sent with every request.
+	Headers map[string]string
+	// ExpectedBodyEquals is the exact response body expected. Surrounding
+	// whitespace is trimmed from both before comparing.
+	ExpectedBodyEquals string
+	// ExpectedBodyContains is a substring the response body must contain.
+	ExpectedBodyContains string
+	// ExpectedBodyRegex is a pattern the response body must match.
+	ExpectedBodyRegex *regexp.Regexp
+	// ExpectedJSONPath is a dotted path that must exist in the JSON response body.
+	ExpectedJSONPath string
+	// ExpectedJSONValue is the value expected at ExpectedJSONPath. An empty
+	// value only requires the path to exist.
+	ExpectedJSONValue string
+	// ExpectedContentEncoding is the Content-Encoding the response must use.
+	ExpectedContentEncoding string
+	// MinCompressionRatio fails a response whose decoded body is less than
+	// this many times larger than the bytes on the wire. It needs an explicit
+	// Accept-Encoding header so the transport leaves the body compressed.
+	// Zero disables the check.
+	MinCompressionRatio float64
+	// ExpectedResponseHeaders are headers the response must carry.
+	ExpectedResponseHeaders map[string]string
+	// ForbiddenResponseHeaders are headers the response must not carry, such
+	// as Server or X-Powered-By.
+	ForbiddenResponseHeaders []string
+	// BearerToken is sent as an Authorization header when set.
+	BearerToken string
+	// BasicAuthUsername is the username for HTTP basic authentication.
+	BasicAuthUsername string
+	// BasicAuthPassword is the password for HTTP basic authentication.
+	BasicAuthPassword string
+	// InsecureSkipVerify disables TLS certificate verification.
+	InsecureSkipVerify bool
+	// RootCAs are the trusted certificate authorities when set.
+	RootCAs *x509.CertPool
+	// ClientCertificates are presented to servers that request client auth.
+	ClientCertificates []tls.Certificate
+	// MaxResponseTimeMs fails a request that takes longer than this many
+	// milliseconds. Zero disables the limit.
+	MaxResponseTimeMs int
+	// MaxDNSTimeMs fails a request whose DNS lookup takes longer than this
+	// many milliseconds. Zero disables the limit.
+	MaxDNSTimeMs int
+	// Retries is how many times a connection-level error, or a status in
+	// RetryOnStatus, is retried before the check is counted as failed.
+	Retries int
+	// RetryBackoffMs is the delay before the first retry. Each further retry
+	// doubles the delay.
+	RetryBackoffMs int
+	// RetryOnStatus lists the failing status codes that are retried like
+	// connection-level errors. A nil matcher retries no status codes.
+	RetryOnStatus *StatusMatcher
+	// MaxRetryAfterSeconds caps the wait requested by the Retry-After header
+	// of a retried 429 or 503 response, which replaces the backoff delay.
+	// Zero ignores the header.
+	MaxRetryAfterSeconds int
+	// FollowRedirects controls whether redirects are followed.
+	FollowRedirects bool
+	// MaxRedirects fails a request that is redirected more than this many
+	// times. Zero keeps Go's default limit of 10.
+	MaxRedirects int
+	// Concurrency is the number of workers sending requests in parallel.
+	Concurrency int
+	// RequireHTTP2 fails a request that does not negotiate HTTP/2.
+	RequireHTTP2 bool
+	// ProxyURL routes every request through this proxy when set. Otherwise
+	// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY are honored.
+	ProxyURL *url.URL
+	// CheckDeadlineSeconds bounds the whole run. Zero disables the deadline.
+	CheckDeadlineSeconds int
+	// WarmupRequests is how many requests are sent to each URL before the
+	// measured run. Their results are not counted.
+	WarmupRequests int
+	// LoginURL is requested before the check to obtain session cookies.
+	LoginURL *url.URL
+	// LoginRequestType is the HTTP method for the login request.
+	LoginRequestType string
+	// LoginRequestBody is the body sent with the login request.
+	LoginRequestBody string
+	// RequestCookies are sent with every request.
+	RequestCookies []*http.Cookie
+	// RedactQueryParams lists query parameters whose values are masked
+	// whenever a URL is logged or reported.
+	RedactQueryParams []string
+	// MinTLSVersion is the lowest TLS version the client accepts. Zero keeps
+	// Go's default.
+	MinTLSVersion uint16
+	// AssertMinTLSVersion fails a request that negotiates a TLS version below
+	// MinTLSVersion instead of refusing the handshake.
+	AssertMinTLSVersion bool
+	// CertExpiryWarningDays flags a server certificate that expires within
+	// this many days. Zero disables the check.
+	CertExpiryWarningDays int
+	// CertExpiryFail fails the request instead of logging a warning when the
+	// certificate expires within CertExpiryWarningDays.
+	CertExpiryFail bool
+	// HostOverride is sent as the Host header and used as the TLS server name
+	// when set, so a specific backend can be targeted by address.
+	HostOverride string
+	// StatusWeights assigns partial scores to response statuses. When empty
+	// every passing check scores 1 and every failing check scores 0.
+	StatusWeights []StatusWeight
+	// DisableKeepAlives opens a fresh connection for every request.
+	DisableKeepAlives bool
+	// MaxIdleConns caps the idle connections kept for reuse, in total and per
+	// host. Zero keeps Go's defaults.
+	MaxIdleConns int
+	// SecondsBackoffFactor multiplies the pause between requests after each
+	// request. One keeps the pause fixed.
+	SecondsBackoffFactor float64
+	// SecondsMax caps the growing pause between requests, in seconds. Zero
+	// leaves it uncapped.
+	SecondsMax int
+	// RequestContentType is sent as the Content-Type of requests that carry a
+	// body, unless Headers sets one.
+	RequestContentType string
+	// InitialDelaySeconds is how long to wait before the first request,
+	// including login. Zero starts immediately.
+	InitialDelaySeconds int
+	// CacheBust appends a unique query parameter to every check request so
+	// caches in front of the target are bypassed.
+	CacheBust bool
+	// MaxBodyBytes caps how much of a response body is read for assertions.
+	// Zero uses DefaultMaxBodyBytes.
+	MaxBodyBytes int
+	// FailOnLargeBody fails a check whose body exceeds MaxBodyBytes instead of
+	// matching against the truncated body.
+	FailOnLargeBody bool
+	// IPVersion restricts connections to IPv4 when 4 or IPv6 when 6. Zero
+	// lets the dialer pick either family.
+	IPVersion int
+	// UserAgent is sent with every request, including login. Empty keeps the
+	// Go default.
+	UserAgent string
+	// ExpectedFinalURL is where the request must land, compared with the last
+	// URL when redirects are followed and with the Location header otherwise.
+	// A trailing "*" matches by prefix and a leading and trailing "*" matches
+	// a substring.
+	ExpectedFinalURL string
+	// EarlyExit stops starting requests once the remaining ones could no
+	// longer bring the score up to PassingPercent, or once more than
+	// MaxFailures checks have failed.
+	EarlyExit bool
+	// IfNoneMatch is sent as the If-None-Match header on every check request,
+	// so a matching ETag can be asserted with an expected 304 status.
+	IfNoneMatch string
+	// JitterPercent randomizes each pause by up to this percent of the
+	// interval in either direction, from 0 to 100.
+	JitterPercent int
+	// RandomSeed makes the jitter reproducible. Zero seeds from the clock.
+	RandomSeed int64
+	// ExpectedJSONSchema is a schema the JSON response body must match.
+	ExpectedJSONSchema *JSONSchema
+	// MaxTTFBMs fails a request whose first response byte takes longer than
+	// this many milliseconds. Zero disables the limit.
+	MaxTTFBMs int
+	// Protocol selects how each URL is checked: ProtocolHTTP, ProtocolGRPC,
+	// or ProtocolWebSocket.
+	Protocol string
+	// GRPCService is the service name sent in gRPC health checks. Empty asks
+	// about the server as a whole.
+	GRPCService string
+	// WebSocketPing sends a ping after a WebSocket upgrade and requires the
+	// matching pong.
+	WebSocketPing bool
+	// DialTimeoutMs bounds each connection attempt, separately from
+	// RequestTimeout, so unreachable hosts fail fast. Zero keeps the 30 second
+	// transport default.
+	DialTimeoutMs int
+	// RotateHeader names a header whose value cycles through
+	// RotateHeaderValues, one value per request to each URL, so individual
+	// backends behind a router can be checked in turn.
+	RotateHeader string
+	// RotateHeaderValues are the values RotateHeader cycles through.
+	RotateHeaderValues []string
+	// SuccessJSONPath names a value to extract from successful JSON
+	// responses, such as a version, using the EXPECTED_JSON_PATH syntax. The
+	// last extracted value is kept in Summary.SuccessValue.
+	SuccessJSONPath string
+	// HostAliases maps lowercase host names to the IP addresses dialed in
+	// their place, like /etc/hosts for this check only. The request URL, Host
+	// header, and TLS server name keep the original name.
+	HostAliases map[string]string
+	// TrailingWindow requires the last this many checks to complete to all
+	// pass, on top of the other pass criteria, so a target that recovered and
+	// then failed again at the end of the run is caught. Zero disables it.
+	TrailingWindow int
+	// ExpectedStreamLine reads the response body line by line and passes as
+	// soon as a line equal to it arrives, without waiting for the body to
+	// end. Surrounding whitespace is ignored.
+	ExpectedStreamLine string
+	// MaxResponseHeaderBytes caps the size of the response headers, so a
+	// target sending huge headers cannot exhaust memory. Zero keeps the Go
+	// default of 10 MiB.
+	MaxResponseHeaderBytes int64
+	// IdempotencyCheck sends each passing check request a second time and
+	// fails when the repeat differs, comparing status codes with
+	// IdempotencyStatus and also bodies with IdempotencyBody. Empty disables
+	// it.
+	IdempotencyCheck string
+	// PassOnAnySuccess passes the run when at least one check passed, in
+	// place of MaxFailures and PassingPercent. It is a deliberately weak
+	// health model for lenient liveness checks.
+	PassOnAnySuccess bool
+	// OnResult is called with the outcome of every measured request when set.
+	// It may be called from several goroutines at once.
+	OnResult func(Result)
+	// OnWait is called when set before a worker blocks for up to delay
+	// without completing a check: during a request attempt, bounded by
+	// RequestTimeout, a retry backoff, or a pacing pause. It lets a liveness
+	// probe tell a long but bounded wait from a wedged run. It may be called
+	// from several goroutines at once.
+	OnWait func(delay time.Duration)
+}
+
+// NewConfig returns a Config populated with the default settings. CheckURLs
+// must be set before the config is passed to Run.
+func NewConfig() *Config {
+	// Fill in every setting with a non-zero default.
+	return &Config{
+		Count:                DefaultCount,
+		PassingPercent:       DefaultPassingPercent,
+		MaxFailures:          DefaultMaxFailures,
+		Protocol:             ProtocolHTTP,
+		RequestType:          DefaultRequestType,
+		ExpectedStatus:       NewStatusMatcher(DefaultExpectedStatusCode),
+		RequestTimeout:       DefaultRequestTimeout,
+		RetryBackoffMs:       DefaultRetryBackoffMs,
+		MaxRetryAfterSeconds: DefaultMaxRetryAfterSeconds,
+		FollowRedirects:      true,
+		Concurrency:          DefaultConcurrency,
+		LoginRequestType:     http.MethodGet,
+		RedactQueryParams:    DefaultRedactQueryParams,
+		SecondsBackoffFactor: 1,
+		RequestContentType:   DefaultRequestContentType,
+		MaxBodyBytes:         DefaultMaxBodyBytes,
+		UserAgent:            DefaultUserAgent,
+		EarlyExit:            true,
+	}
+}
+
+// ErrMissingRequestBody is returned by Validate for a POST, PUT, or PATCH
+// without a body when AllowEmptyBody is not set.
+var ErrMissingRequestBody = errors.New("missing request body")
+
+// bodyMethods lists the methods that need a RequestBody unless AllowEmptyBody
+// is set.
+var bodyMethods = []string{
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+}
+
+// Validate reports a config that Run cannot use, such as one built without
+// NewConfig that lacks an ExpectedStatus or workers. Only an explicit
+// RequestBody is sent, so POST, PUT, and PATCH need one unless AllowEmptyBody
+// is set. gRPC and WebSocket checks build their own requests and are not
+// affected.
+func (cfg *Config) Validate() error {
+	// Require something to check and workers to check it.
+	if len(cfg.CheckURLs) == 0 {
+		return fmt.Errorf("no check URLs configured")
+	}
+	if cfg.Count < 1 {
+		return fmt.Errorf("count must be at least 1, got %d", cfg.Count)
+	}
+	if cfg.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", cfg.Concurrency)
+	}
+	if cfg.ExpectedStatus == nil {
+		return fmt.Errorf("no expected status configured")
+	}
+
+	// Basic auth is only sent with both halves, so refuse to drop it silently.
+	if len(cfg.BasicAuthUsername) != 0 && len(cfg.BasicAuthPassword) == 0 {
+		return fmt.Errorf("basic auth username is set but the password is empty")
+	}
+	if len(cfg.BasicAuthPassword) != 0 && len(cfg.BasicAuthUsername) == 0 {
+		return fmt.Errorf("basic auth password is set but the username is empty")
+	}
+
+	// Refuse to send a body method without a body by accident.
+	if cfg.Protocol == ProtocolHTTP && slices.Contains(bodyMethods, cfg.RequestType) && len(cfg.RequestBody) == 0 && !cfg.AllowEmptyBody {
+		return fmt.Errorf("%w: %s needs a request body unless empty bodies are allowed", ErrMissingRequestBody, cfg.RequestType)
+	}
+
+	return nil
+}
+
+// hasBodyAssertions reports whether any response body assertion is configured.
+func (cfg *Config) hasBodyAssertions() bool {
+	// Any body matcher requires reading the body. HEAD responses never carry one.
+	if cfg.RequestType == http.MethodHead {
+		return false
+	}
+	return cfg.ExpectedJSONSchema != nil || len(cfg.ExpectedBodyEquals) != 0 || len(cfg.ExpectedBodyContains) != 0 || cfg.ExpectedBodyRegex != nil || len(cfg.ExpectedJSONPath) != 0
+}
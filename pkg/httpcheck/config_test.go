@@ -0,0 +1,125 @@
+package httpcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestConfigValidate checks body methods need a body unless empty bodies are
+// allowed, and that a config Run cannot use is rejected.
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestType    string
+		requestBody    string
+		allowEmptyBody bool
+		protocol       string
+		zeroCount      bool
+		noURLs         bool
+		// modify changes the config after the fields above are applied.
+		modify      func(cfg *Config)
+		wantErr     string
+		wantMissing bool
+	}{
+		{name: "GET without a body", requestType: http.MethodGet},
+		{name: "DELETE without a body", requestType: http.MethodDelete},
+		{name: "POST with a body", requestType: http.MethodPost, requestBody: "{}"},
+		{name: "POST without a body", requestType: http.MethodPost, wantErr: "POST needs a request body", wantMissing: true},
+		{name: "PUT without a body", requestType: http.MethodPut, wantErr: "PUT needs a request body", wantMissing: true},
+		{name: "PATCH without a body", requestType: http.MethodPatch, wantErr: "PATCH needs a request body", wantMissing: true},
+		{name: "POST with an empty body allowed", requestType: http.MethodPost, allowEmptyBody: true},
+		{name: "gRPC builds its own body", requestType: http.MethodPost, protocol: ProtocolGRPC},
+		{name: "WebSocket builds its own request", requestType: http.MethodPut, protocol: ProtocolWebSocket},
+		{name: "zero count", requestType: http.MethodGet, zeroCount: true, wantErr: "count must be at least 1, got 0"},
+		{name: "no URLs", requestType: http.MethodGet, noURLs: true, wantErr: "no check URLs configured"},
+		{name: "no workers", requestType: http.MethodGet, modify: func(cfg *Config) { cfg.Concurrency = 0 }, wantErr: "concurrency must be at least 1, got 0"},
+		{name: "no expected status", requestType: http.MethodGet, modify: func(cfg *Config) { cfg.ExpectedStatus = nil }, wantErr: "no expected status configured"},
+		{name: "basic auth pair", requestType: http.MethodGet, modify: func(cfg *Config) { cfg.BasicAuthUsername, cfg.BasicAuthPassword = "user", "secret" }},
+		{name: "basic auth username alone", requestType: http.MethodGet, modify: func(cfg *Config) { cfg.BasicAuthUsername = "user" }, wantErr: "basic auth username is set but the password is empty"},
+		{name: "basic auth password alone", requestType: http.MethodGet, modify: func(cfg *Config) { cfg.BasicAuthPassword = "secret" }, wantErr: "basic auth password is set but the username is empty"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.CheckURLs = []*url.URL{mustParseURL(t, "https://example.com")}
+			if test.noURLs {
+				cfg.CheckURLs = nil
+			}
+			if test.zeroCount {
+				cfg.Count = 0
+			}
+			if len(test.protocol) != 0 {
+				cfg.Protocol = test.protocol
+			}
+			cfg.RequestType = test.requestType
+			cfg.RequestBody = test.requestBody
+			cfg.AllowEmptyBody = test.allowEmptyBody
+			if test.modify != nil {
+				test.modify(cfg)
+			}
+			err := cfg.Validate()
+			checkBodyError(t, err, test.wantErr)
+			if errors.Is(err, ErrMissingRequestBody) != test.wantMissing {
+				t.Errorf("Validate error %v is ErrMissingRequestBody = %v, want %v", err, !test.wantMissing, test.wantMissing)
+			}
+		})
+	}
+}
+
+// TestRunValidates checks Run sends nothing for a config that fails Validate,
+// including one built without NewConfig, and that a new config sends no body
+// by default.
+func TestRunValidates(t *testing.T) {
+	var requests atomic.Int64
+	bodies := make(chan int64, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		bodies <- r.ContentLength
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	if NewConfig().RequestBody != "" {
+		t.Fatalf("NewConfig RequestBody = %q, want none", NewConfig().RequestBody)
+	}
+
+	// A POST without a body is refused before any request.
+	cfg := newTestConfig(t, server.URL)
+	cfg.RequestType = http.MethodPost
+	_, err := Run(context.Background(), cfg)
+	if !errors.Is(err, ErrMissingRequestBody) || !strings.Contains(err.Error(), "invalid config") {
+		t.Fatalf("Run error = %v, want ErrMissingRequestBody", err)
+	}
+	if requests.Load() != 0 {
+		t.Fatalf("Run sent %d requests for an invalid config", requests.Load())
+	}
+
+	// A config built without NewConfig is refused rather than panicking or
+	// passing without checks.
+	_, err = Run(context.Background(), &Config{CheckURLs: cfg.CheckURLs, Count: 1})
+	if err == nil || !strings.Contains(err.Error(), "concurrency must be at least 1") {
+		t.Fatalf("Run error = %v, want a concurrency error", err)
+	}
+	_, err = Run(context.Background(), &Config{CheckURLs: cfg.CheckURLs, Count: 1, Concurrency: 1})
+	if err == nil || !strings.Contains(err.Error(), "no expected status configured") {
+		t.Fatalf("Run error = %v, want an expected status error", err)
+	}
+	if requests.Load() != 0 {
+		t.Fatalf("Run sent %d requests for an invalid config", requests.Load())
+	}
+
+	// Allowing an empty body sends one.
+	cfg.AllowEmptyBody = true
+	summary := runTestConfig(t, cfg)
+	if !summary.Passed(cfg, cfg.Count) {
+		t.Fatalf("check failed: %v", summary.FailureMessages())
+	}
+	if length := <-bodies; length != 0 {
+		t.Errorf("request body length = %d, want 0", length)
+	}
+}
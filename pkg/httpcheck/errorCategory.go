@@ -0,0 +1,99 @@
+package httpcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrorCategory names the kind of failure behind a request that got no
+// response, or behind a refused WebSocket upgrade.
+type ErrorCategory string
+
+const (
+	// CategoryDNS is a failed or timed out name lookup.
+	CategoryDNS ErrorCategory = "dns"
+	// CategoryConnectionRefused is a dial the target actively refused.
+	CategoryConnectionRefused ErrorCategory = "connection_refused"
+	// CategoryConnectionReset is a connection the target reset or closed.
+	CategoryConnectionReset ErrorCategory = "connection_reset"
+	// CategoryTLS is a failed handshake or certificate verification.
+	CategoryTLS ErrorCategory = "tls"
+	// CategoryDialTimeout is a connection attempt that ran past
+	// DialTimeoutMs.
+	CategoryDialTimeout ErrorCategory = "dial_timeout"
+	// CategoryTimeout is a request that ran past its timeout or the check
+	// deadline.
+	CategoryTimeout ErrorCategory = "timeout"
+	// CategoryCancelled is a request stopped by the run ending.
+	CategoryCancelled ErrorCategory = "cancelled"
+	// CategoryRedirect is a request stopped by the redirect policy.
+	CategoryRedirect ErrorCategory = "redirect"
+	// CategoryConnection is any other transport error.
+	CategoryConnection ErrorCategory = "connection"
+	// CategoryWebSocketHandshake is a response that did not complete a
+	// WebSocket upgrade.
+	CategoryWebSocketHandshake ErrorCategory = "websocket_handshake"
+)
+
+// classifyError returns the category of a request error. ctxErr is the run
+// context's error, which takes precedence since it explains the others.
+func classifyError(err error, ctxErr error) ErrorCategory {
+	// The run ending or its deadline passing explains any error.
+	if ctxErr != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return CategoryTimeout
+		}
+		return CategoryCancelled
+	}
+	if errors.Is(err, errTooManyRedirects) {
+		return CategoryRedirect
+	}
+
+	// Name lookups come first since they can also time out.
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return CategoryDNS
+	}
+	if isDialTimeout(err) {
+		return CategoryDialTimeout
+	}
+	if isTimeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return CategoryTimeout
+	}
+	if isTLSError(err) {
+		return CategoryTLS
+	}
+
+	// Tell a refused dial from a dropped connection.
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return CategoryConnectionRefused
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return CategoryConnectionReset
+	}
+
+	return CategoryConnection
+}
+
+// isTLSError reports whether err came from the TLS handshake or certificate
+// verification.
+func isTLSError(err error) bool {
+	// Check each error type the TLS stack returns.
+	var verificationErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+
+	return errors.As(err, &verificationErr) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &invalidErr) ||
+		errors.As(err, &hostnameErr)
+}
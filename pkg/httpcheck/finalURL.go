@@ -0,0 +1,53 @@
+package httpcheck
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// validateFinalURL checks where the request ended up against
+// cfg.ExpectedFinalURL. With redirects followed that is the URL of the last
+// request. Otherwise it is the Location of a redirect response, or the
+// request URL when the response was not a redirect. The CacheBust parameter
+// is ignored wherever it was carried along.
+func validateFinalURL(cfg *Config, response *http.Response) error {
+	// Skip when no final URL is expected.
+	if len(cfg.ExpectedFinalURL) == 0 {
+		return nil
+	}
+
+	// Work out where the request landed.
+	finalURL := response.Request.URL
+	if !cfg.FollowRedirects {
+		location, err := response.Location()
+		if err == nil {
+			finalURL = location
+		}
+	}
+	if cfg.CacheBust {
+		finalURL = stripCacheBust(finalURL)
+	}
+	if !finalURLMatches(cfg.ExpectedFinalURL, finalURL.String()) {
+		return fmt.Errorf("landed on %s, expected %s", cfg.RedactURL(finalURL), cfg.ExpectedFinalURL)
+	}
+
+	return nil
+}
+
+// finalURLMatches reports whether actual satisfies want. A want that starts
+// and ends with "*" matches a substring, one that only ends with "*" matches
+// a prefix, and any other want must match exactly.
+func finalURLMatches(want string, actual string) bool {
+	// Strip the wildcards to find the match mode.
+	prefix, isPrefix := strings.CutSuffix(want, "*")
+	if !isPrefix {
+		return actual == want
+	}
+	substring, isSubstring := strings.CutPrefix(prefix, "*")
+	if isSubstring {
+		return strings.Contains(actual, substring)
+	}
+
+	return strings.HasPrefix(actual, prefix)
+}
@@ -0,0 +1,82 @@
+package httpcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestStripCacheBust checks only the cache-busting parameter is removed.
+func TestStripCacheBust(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{name: "only parameter", raw: "https://example.com/a?_cb=abc-1", want: "https://example.com/a"},
+		{name: "last parameter", raw: "https://example.com/a?x=1&_cb=abc-1", want: "https://example.com/a?x=1"},
+		{name: "middle parameter", raw: "https://example.com/a?x=1&_cb=abc-1&y=%2F", want: "https://example.com/a?x=1&y=%2F"},
+		{name: "repeated parameter", raw: "https://example.com/a?_cb=1&_cb=2", want: "https://example.com/a"},
+		{name: "similar name kept", raw: "https://example.com/a?_cbx=1&x_cb=2", want: "https://example.com/a?_cbx=1&x_cb=2"},
+		{name: "no query", raw: "https://example.com/a", want: "https://example.com/a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := mustParseURL(t, test.raw)
+			got := stripCacheBust(original).String()
+			if got != test.want {
+				t.Errorf("stripCacheBust(%s) = %s, want %s", test.raw, got, test.want)
+			}
+			if original.String() != test.raw {
+				t.Errorf("stripCacheBust changed its input to %s", original)
+			}
+		})
+	}
+}
+
+// TestExpectedFinalURLWithCacheBust checks an exact final URL still matches
+// when the cache-busting parameter is carried through a redirect.
+func TestExpectedFinalURLWithCacheBust(t *testing.T) {
+	// Redirect /start to /end, keeping the query string like many servers do.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/end?"+r.URL.RawQuery, http.StatusFound)
+	})
+	mux.HandleFunc("/end", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		path            string
+		cacheBust       bool
+		followRedirects bool
+		expected        string
+		wantPass        bool
+	}{
+		{name: "followed redirect", path: "/start?region=eu", cacheBust: true, followRedirects: true, expected: server.URL + "/end?region=eu", wantPass: true},
+		{name: "followed redirect without other parameters", path: "/start", cacheBust: true, followRedirects: true, expected: server.URL + "/end", wantPass: true},
+		{name: "location header", path: "/start?region=eu", cacheBust: true, expected: server.URL + "/end?region=eu", wantPass: true},
+		{name: "no redirect", path: "/end?region=eu", cacheBust: true, followRedirects: true, expected: server.URL + "/end?region=eu", wantPass: true},
+		{name: "prefix", path: "/start", cacheBust: true, followRedirects: true, expected: server.URL + "/end*", wantPass: true},
+		{name: "wrong landing page", path: "/start", cacheBust: true, followRedirects: true, expected: server.URL + "/start", wantPass: false},
+		{name: "without cache bust", path: "/start?region=eu", followRedirects: true, expected: server.URL + "/end?region=eu", wantPass: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newTestConfig(t, server.URL+test.path)
+			cfg.CacheBust = test.cacheBust
+			cfg.FollowRedirects = test.followRedirects
+			if !test.followRedirects {
+				cfg.ExpectedStatus = NewStatusMatcher(http.StatusFound)
+			}
+			cfg.ExpectedFinalURL = test.expected
+			summary := runTestConfig(t, cfg)
+			if summary.Passed(cfg, cfg.Count) != test.wantPass {
+				t.Errorf("passed = %v, want %v, failures: %v", !test.wantPass, test.wantPass, summary.FailureMessages())
+			}
+		})
+	}
+}
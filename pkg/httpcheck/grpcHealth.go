@@ -0,0 +1,173 @@
+package httpcheck
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// grpcHealthPath is the method path of grpc.health.v1.Health/Check.
+const grpcHealthPath = "/grpc.health.v1.Health/Check"
+
+// grpcServingStatuses names the HealthCheckResponse.ServingStatus values.
+var grpcServingStatuses = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// grpcServing is the ServingStatus a healthy service reports.
+const grpcServing = 1
+
+// grpcHealthAPIRequest turns request into a gRPC health check of service. The
+// check URL only supplies the scheme and address, where https uses TLS and
+// http uses HTTP/2 without TLS. Custom headers are sent as gRPC metadata.
+func grpcHealthAPIRequest(request APIRequest, service string) APIRequest {
+	// Call the health method on the same address.
+	healthURL := *request.URL
+	healthURL.Path = grpcHealthPath
+	healthURL.RawPath = ""
+	healthURL.RawQuery = ""
+	healthURL.Fragment = ""
+	request.URL = &healthURL
+
+	// Send a framed HealthCheckRequest and ask for the status trailers.
+	request.Type = http.MethodPost
+	request.Body = grpcHealthRequestBody(service)
+	request.ContentType = "application/grpc"
+	request.IfNoneMatch = ""
+	headers := make(map[string]string, len(request.Headers)+1)
+	for key, value := range request.Headers {
+		headers[key] = value
+	}
+	headers["TE"] = "trailers"
+	request.Headers = headers
+
+	return request
+}
+
+// grpcHealthRequestBody encodes a HealthCheckRequest for service as a single
+// uncompressed gRPC message.
+func grpcHealthRequestBody(service string) []byte {
+	// Field 1 is the service name. An empty name asks about the server.
+	message := []byte{}
+	if len(service) != 0 {
+		message = append(message, 0x0a)
+		message = binary.AppendUvarint(message, uint64(len(service)))
+		message = append(message, service...)
+	}
+
+	// Prefix the compression flag and the message length.
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+
+	return append(frame, message...)
+}
+
+// validateGRPCResponse requires a gRPC health response reporting SERVING.
+func validateGRPCResponse(cfg *Config, parsedURL *url.URL, response *http.Response, body *cachedBody) error {
+	// Require a gRPC response before reading it.
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("got a %d from the gRPC health check of %s", response.StatusCode, cfg.RedactURL(parsedURL))
+	}
+	contentType := response.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/grpc") {
+		return fmt.Errorf("the gRPC health check of %s got a non-gRPC response with Content-Type %q", cfg.RedactURL(parsedURL), contentType)
+	}
+
+	// Read the message so the trailers arrive. A trailers-only response
+	// carries its status in the headers instead.
+	data, err := body.read()
+	if err != nil {
+		return fmt.Errorf("error reading the gRPC health response from %s: %w", cfg.RedactURL(parsedURL), err)
+	}
+	status := response.Header.Get("Grpc-Status")
+	message := response.Header.Get("Grpc-Message")
+	if len(status) == 0 {
+		status = response.Trailer.Get("Grpc-Status")
+		message = response.Trailer.Get("Grpc-Message")
+	}
+	if status != "0" {
+		if len(status) == 0 {
+			return fmt.Errorf("the gRPC health check of %s returned no grpc-status", cfg.RedactURL(parsedURL))
+		}
+		return fmt.Errorf("the gRPC health check of %s failed with grpc-status %s: %s", cfg.RedactURL(parsedURL), status, message)
+	}
+
+	// Decode the serving status.
+	servingStatus, err := parseGRPCHealthResponse(data)
+	if err != nil {
+		return fmt.Errorf("error parsing the gRPC health response from %s: %w", cfg.RedactURL(parsedURL), err)
+	}
+	if servingStatus != grpcServing {
+		name, ok := grpcServingStatuses[servingStatus]
+		if !ok {
+			name = fmt.Sprint(servingStatus)
+		}
+		return fmt.Errorf("the gRPC health check of %s reported %s, expected SERVING", cfg.RedactURL(parsedURL), name)
+	}
+
+	return nil
+}
+
+// parseGRPCHealthResponse decodes the ServingStatus of a single framed
+// HealthCheckResponse. A missing status field decodes as UNKNOWN.
+func parseGRPCHealthResponse(data []byte) (uint64, error) {
+	// Unwrap the message frame.
+	if len(data) < 5 {
+		return 0, fmt.Errorf("expected a 5 byte message header, got %d bytes", len(data))
+	}
+	if data[0] != 0 {
+		return 0, fmt.Errorf("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(data[1:5])
+	message := data[5:]
+	if uint64(len(message)) < uint64(length) {
+		return 0, fmt.Errorf("message is truncated, expected %d bytes and got %d", length, len(message))
+	}
+	message = message[:length]
+
+	// Walk the fields, keeping the last status and skipping unknown fields.
+	var status uint64
+	for len(message) != 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, fmt.Errorf("malformed field key")
+		}
+		message = message[n:]
+		switch key & 7 {
+		case 0:
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return 0, fmt.Errorf("malformed varint field")
+			}
+			message = message[n:]
+			if key>>3 == 1 {
+				status = value
+			}
+		case 1:
+			if len(message) < 8 {
+				return 0, fmt.Errorf("truncated fixed64 field")
+			}
+			message = message[8:]
+		case 2:
+			size, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < size {
+				return 0, fmt.Errorf("truncated length-delimited field")
+			}
+			message = message[n+int(size):]
+		case 5:
+			if len(message) < 4 {
+				return 0, fmt.Errorf("truncated fixed32 field")
+			}
+			message = message[4:]
+		default:
+			return 0, fmt.Errorf("unsupported wire type %d", key&7)
+		}
+	}
+
+	return status, nil
+}
@@ -0,0 +1,245 @@
+package httpcheck
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Golden HealthCheckResponse frames: a 5 byte header followed by the message.
+var (
+	// grpcServingFrame reports SERVING.
+	grpcServingFrame = []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01}
+	// grpcNotServingFrame reports NOT_SERVING.
+	grpcNotServingFrame = []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x02}
+)
+
+// TestGRPCHealthRequestBody checks the HealthCheckRequest encoding against
+// golden bytes.
+func TestGRPCHealthRequestBody(t *testing.T) {
+	longName := strings.Repeat("s", 200)
+	tests := []struct {
+		name    string
+		service string
+		want    []byte
+	}{
+		{name: "whole server", service: "", want: []byte{0x00, 0x00, 0x00, 0x00, 0x00}},
+		{name: "service", service: "web", want: []byte{0x00, 0x00, 0x00, 0x00, 0x05, 0x0a, 0x03, 'w', 'e', 'b'}},
+		{name: "qualified service", service: "grpc.health.v1.Health", want: append([]byte{0x00, 0x00, 0x00, 0x00, 0x17, 0x0a, 0x15}, "grpc.health.v1.Health"...)},
+		{name: "two byte length", service: longName, want: append([]byte{0x00, 0x00, 0x00, 0x00, 0xcb, 0x0a, 0xc8, 0x01}, longName...)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := grpcHealthRequestBody(test.service)
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("grpcHealthRequestBody(%q) = % x, want % x", test.service, got, test.want)
+			}
+		})
+	}
+}
+
+// TestParseGRPCHealthResponse checks the ServingStatus is decoded from golden
+// frames and malformed frames are rejected.
+func TestParseGRPCHealthResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    uint64
+		wantErr string
+	}{
+		{name: "serving", data: grpcServingFrame, want: 1},
+		{name: "not serving", data: grpcNotServingFrame, want: 2},
+		{name: "service unknown", data: []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x03}, want: 3},
+		{name: "empty message is unknown", data: []byte{0x00, 0x00, 0x00, 0x00, 0x00}, want: 0},
+		{name: "last status wins", data: []byte{0x00, 0x00, 0x00, 0x00, 0x04, 0x08, 0x02, 0x08, 0x01}, want: 1},
+		{name: "unknown fields skipped", data: []byte{
+			0x00, 0x00, 0x00, 0x00, 0x13,
+			0x12, 0x01, 'x', // field 2, length-delimited
+			0x19, 1, 2, 3, 4, 5, 6, 7, 8, // field 3, fixed64
+			0x25, 1, 2, 3, 4, // field 4, fixed32
+			0x08, 0x01,
+		}, want: 1},
+		{name: "bytes after the message ignored", data: append(append([]byte{}, grpcServingFrame...), 0xff, 0xff), want: 1},
+		{name: "short header", data: []byte{0x00, 0x00, 0x00}, wantErr: "expected a 5 byte message header, got 3 bytes"},
+		{name: "compressed", data: []byte{0x01, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01}, wantErr: "compressed messages are not supported"},
+		{name: "truncated message", data: []byte{0x00, 0x00, 0x00, 0x00, 0x04, 0x08, 0x01}, wantErr: "message is truncated, expected 4 bytes and got 2"},
+		{name: "malformed key", data: []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x80}, wantErr: "malformed field key"},
+		{name: "malformed varint", data: []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x80}, wantErr: "malformed varint field"},
+		{name: "truncated fixed64", data: []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x19, 0x01}, wantErr: "truncated fixed64 field"},
+		{name: "truncated length-delimited", data: []byte{0x00, 0x00, 0x00, 0x00, 0x03, 0x12, 0x05, 'x'}, wantErr: "truncated length-delimited field"},
+		{name: "truncated fixed32", data: []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x25, 0x01}, wantErr: "truncated fixed32 field"},
+		{name: "group wire type", data: []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x0b}, wantErr: "unsupported wire type 3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseGRPCHealthResponse(test.data)
+			if len(test.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("parseGRPCHealthResponse error = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseGRPCHealthResponse returned an error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("parseGRPCHealthResponse = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// grpcHealthServer is a fake gRPC health service that answers with a fixed
+// message and status.
+type grpcHealthServer struct {
+	// service is the service name the check must ask about.
+	service string
+	// httpStatus is the HTTP status of the response.
+	httpStatus int
+	// contentType is the Content-Type of the response.
+	contentType string
+	// message is the framed response message, sent before the trailers.
+	message []byte
+	// status is the grpc-status sent in the trailers, or none when empty.
+	status string
+	// statusMessage is the grpc-message sent with the status.
+	statusMessage string
+	// trailersOnly sends the status in the headers without a message.
+	trailersOnly bool
+}
+
+// ServeHTTP checks the request is a gRPC health check over HTTP/2 and writes
+// the configured response.
+func (s *grpcHealthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Refuse anything that is not the expected health check.
+	data, _ := io.ReadAll(r.Body)
+	if r.ProtoMajor != 2 || r.Method != http.MethodPost || r.URL.Path != grpcHealthPath ||
+		r.Header.Get("Content-Type") != "application/grpc" || r.Header.Get("TE") != "trailers" ||
+		!bytes.Equal(data, grpcHealthRequestBody(s.service)) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// A trailers-only response carries the status in the headers.
+	w.Header().Set("Content-Type", s.contentType)
+	if s.trailersOnly {
+		w.Header().Set("Grpc-Status", s.status)
+		w.Header().Set("Grpc-Message", s.statusMessage)
+		w.WriteHeader(s.httpStatus)
+		return
+	}
+
+	// Otherwise the status follows the message as trailers.
+	if len(s.status) != 0 {
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	}
+	w.WriteHeader(s.httpStatus)
+	_, _ = w.Write(s.message)
+	if len(s.status) != 0 {
+		w.Header().Set("Grpc-Status", s.status)
+		w.Header().Set("Grpc-Message", s.statusMessage)
+	}
+}
+
+// TestRunGRPCHealth checks gRPC health checks against a real HTTP/2 server,
+// with the status in trailers or in a trailers-only response.
+func TestRunGRPCHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  grpcHealthServer
+		wantErr string
+	}{
+		{
+			name:   "serving",
+			server: grpcHealthServer{service: "web", httpStatus: http.StatusOK, contentType: "application/grpc", message: grpcServingFrame, status: "0"},
+		},
+		{
+			name:   "serving with a content subtype",
+			server: grpcHealthServer{httpStatus: http.StatusOK, contentType: "application/grpc+proto", message: grpcServingFrame, status: "0"},
+		},
+		{
+			name:    "not serving",
+			server:  grpcHealthServer{service: "web", httpStatus: http.StatusOK, contentType: "application/grpc", message: grpcNotServingFrame, status: "0"},
+			wantErr: "reported NOT_SERVING, expected SERVING",
+		},
+		{
+			name:    "unknown serving status",
+			server:  grpcHealthServer{httpStatus: http.StatusOK, contentType: "application/grpc", message: []byte{0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x09}, status: "0"},
+			wantErr: "reported 9, expected SERVING",
+		},
+		{
+			name:    "error status in trailers",
+			server:  grpcHealthServer{httpStatus: http.StatusOK, contentType: "application/grpc", status: "12", statusMessage: "unknown method"},
+			wantErr: "failed with grpc-status 12: unknown method",
+		},
+		{
+			name:    "trailers-only error status",
+			server:  grpcHealthServer{service: "web", httpStatus: http.StatusOK, contentType: "application/grpc", status: "5", statusMessage: "unknown service", trailersOnly: true},
+			wantErr: "failed with grpc-status 5: unknown service",
+		},
+		{
+			name:    "trailers-only success without a message",
+			server:  grpcHealthServer{httpStatus: http.StatusOK, contentType: "application/grpc", status: "0", trailersOnly: true},
+			wantErr: "error parsing the gRPC health response",
+		},
+		{
+			name:    "no status",
+			server:  grpcHealthServer{httpStatus: http.StatusOK, contentType: "application/grpc", message: grpcServingFrame},
+			wantErr: "returned no grpc-status",
+		},
+		{
+			name:    "not a gRPC response",
+			server:  grpcHealthServer{httpStatus: http.StatusOK, contentType: "text/html", message: []byte("<html>")},
+			wantErr: `got a non-gRPC response with Content-Type "text/html"`,
+		},
+		{
+			name:    "HTTP error",
+			server:  grpcHealthServer{httpStatus: http.StatusServiceUnavailable, contentType: "application/grpc"},
+			wantErr: "got a 503 from the gRPC health check",
+		},
+	}
+	for _, test := range tests {
+		for _, useTLS := range []bool{false, true} {
+			name := test.name + " over h2c"
+			if useTLS {
+				name = test.name + " over TLS"
+			}
+			t.Run(name, func(t *testing.T) {
+				// Serve HTTP/2 with prior knowledge, or negotiated over TLS.
+				server := httptest.NewUnstartedServer(&test.server)
+				if useTLS {
+					server.EnableHTTP2 = true
+					server.StartTLS()
+				} else {
+					server.Config.Protocols = &http.Protocols{}
+					server.Config.Protocols.SetUnencryptedHTTP2(true)
+					server.Start()
+				}
+				defer server.Close()
+
+				// The check URL path and query are replaced by the health method.
+				cfg := newTestConfig(t, server.URL+"/ignored?x=1")
+				cfg.Protocol = ProtocolGRPC
+				cfg.GRPCService = test.server.service
+				if useTLS {
+					cfg.RootCAs = x509.NewCertPool()
+					cfg.RootCAs.AddCert(server.Certificate())
+				}
+				summary := runTestConfig(t, cfg)
+				if len(test.wantErr) == 0 {
+					if !summary.Passed(cfg, cfg.Count) {
+						t.Fatalf("check failed: %v", summary.FailureMessages())
+					}
+					return
+				}
+				if summary.FirstFailure == nil || !strings.Contains(summary.FirstFailure.Err.Error(), test.wantErr) {
+					t.Fatalf("failures = %v, want one containing %q", summary.FailureMessages(), test.wantErr)
+				}
+			})
+		}
+	}
+}
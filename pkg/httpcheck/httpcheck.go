@@ -0,0 +1,724 @@
+// Package httpcheck sends HTTP requests to one or more URLs and validates the
+// responses, summarizing how many checks passed.
+package httpcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// APIRequest describes an HTTP request configuration.
+type APIRequest struct {
+	// URL is the parsed URL for the request.
+	URL *url.URL
+	// Type is the HTTP method to use.
+	Type string
+	// Body is the raw request body. A fresh reader is created for every call
+	// so the same request can be sent more than once.
+	Body []byte
+	// Headers are set on the request before it is sent.
+	Headers map[string]string
+	// BearerToken is sent as an Authorization header when set.
+	BearerToken string
+	// BasicAuthUsername is the username for HTTP basic authentication.
+	BasicAuthUsername string
+	// BasicAuthPassword is the password for HTTP basic authentication.
+	BasicAuthPassword string
+	// Cookies are sent with the request.
+	Cookies []*http.Cookie
+	// Timing records connection phase durations when set.
+	Timing *TimingRecorder
+	// RedactQueryParams lists query parameters masked in returned errors.
+	RedactQueryParams []string
+	// Host overrides the Host header when set.
+	Host string
+	// ContentType is sent as the Content-Type header when the request carries
+	// a body. Headers take precedence.
+	ContentType string
+	// UserAgent is sent as the User-Agent header when set. Headers take
+	// precedence.
+	UserAgent string
+	// IfNoneMatch is sent as the If-None-Match header when set. Headers take
+	// precedence.
+	IfNoneMatch string
+}
+
+// ErrInterrupted is returned by Run when ctx is cancelled before every check
+// ran. The partial summary is returned alongside it.
+var ErrInterrupted = errors.New("check interrupted")
+
+// Run executes the request loop against every configured URL and returns a
+// summary. No new requests are started once ctx is done or the configured
+// check deadline passes. cfg.OnResult is called after every request when set.
+// A config that fails Validate is rejected before any request is sent.
+func Run(ctx context.Context, cfg *Config) (*Summary, error) {
+	// Refuse a config that cannot run before sending anything.
+	err := cfg.Validate()
+	if err != nil {
+		return &Summary{}, fmt.Errorf("invalid config: %w", err)
+	}
+
+	// Bound the whole run by the configured deadline.
+	if cfg.CheckDeadlineSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.CheckDeadlineSeconds)*time.Second)
+		defer cancel()
+	}
+
+	// Initialize counters.
+	log.Infoln("Beginning check.")
+	summary := &Summary{trailing: make([]bool, cfg.TrailingWindow)}
+	client := newHTTPClient(cfg)
+
+	// Give the target time to become reachable before the first request.
+	if cfg.InitialDelaySeconds > 0 {
+		log.Infoln("Waiting", cfg.InitialDelaySeconds, "seconds before the first request")
+		sleepContext(ctx, time.Duration(cfg.InitialDelaySeconds)*time.Second)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return summary, fmt.Errorf("%w during the initial delay", ErrInterrupted)
+		}
+	}
+
+	// Log in first when a session is required.
+	if cfg.LoginURL != nil {
+		err := login(ctx, client, cfg)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return summary, fmt.Errorf("%w before logging in", ErrInterrupted)
+		}
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	// Warm up each URL before measuring.
+	runWarmup(ctx, client, cfg)
+
+	// Spread the requests across the workers. Each worker claims the next
+	// request index until every URL has been queried cfg.Count times, rotating
+	// through the URLs so they are exercised evenly. With early exit, no new
+	// request starts once the run can no longer pass.
+	totalChecks := int64(cfg.Count * len(cfg.CheckURLs))
+	var claimed atomic.Int64
+	var stopEarly sync.Once
+	next := func() (*url.URL, int, bool) {
+		if ctx.Err() != nil {
+			return nil, 0, false
+		}
+		if cfg.EarlyExit && !summary.canStillPass(cfg, int(totalChecks)) {
+			stopEarly.Do(func() {
+				if cfg.MaxFailures >= 0 {
+					log.Warnln("Stopping early: more than", cfg.MaxFailures, "checks have failed")
+					return
+				}
+				log.Warnln("Stopping early: the remaining checks can no longer reach", cfg.PassingPercent, "percent")
+			})
+			return nil, 0, false
+		}
+		index := claimed.Add(1) - 1
+		if index >= totalChecks {
+			return nil, 0, false
+		}
+		return cfg.CheckURLs[index%int64(len(cfg.CheckURLs))], int(index) + 1, true
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < cfg.Concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runWorker(ctx, client, cfg, worker, next, summary)
+		}()
+	}
+	wg.Wait()
+	summary.finish()
+
+	// Roll up the failures that were only logged the first time.
+	for _, message := range summary.repeatedFailureMessages() {
+		log.Warnln("Repeated failure:", message)
+	}
+
+	// Report an interrupted run separately from a failed one.
+	if errors.Is(ctx.Err(), context.Canceled) && int64(summary.ChecksRan) < totalChecks {
+		return summary, fmt.Errorf("%w after %d of %d checks", ErrInterrupted, summary.ChecksRan, totalChecks)
+	}
+
+	// Fail the run when the deadline stopped it early.
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && int64(summary.ChecksRan) < totalChecks {
+		return summary, fmt.Errorf("check deadline of %d seconds reached after %d of %d checks, %d failed", cfg.CheckDeadlineSeconds, summary.ChecksRan, totalChecks, summary.ChecksFailed)
+	}
+
+	return summary, nil
+}
+
+// runWarmup sends cfg.WarmupRequests requests to each URL. Their results are
+// logged but never counted toward the summary.
+func runWarmup(ctx context.Context, client *http.Client, cfg *Config) {
+	// Skip when no warm-up is configured.
+	if cfg.WarmupRequests == 0 {
+		return
+	}
+	log.Infoln("Sending", cfg.WarmupRequests, "warm-up requests to each URL")
+
+	// Pace warm-up requests the same way as measured requests.
+	pause := time.Duration(cfg.Seconds) * time.Second
+	for i := 0; i < cfg.WarmupRequests; i++ {
+		for _, parsedURL := range cfg.CheckURLs {
+			if ctx.Err() != nil {
+				return
+			}
+			result := runCheck(ctx, client, cfg, parsedURL, 0)
+			if result.Err != nil {
+				log.WithFields(resultFields(cfg, parsedURL, result)).Warnln("Warm-up request failed:", result.Err)
+			}
+			notifyWait(cfg.OnWait, pause)
+			sleepContext(ctx, pause)
+		}
+	}
+	log.Infoln("Warm-up complete.")
+}
+
+// runWorker performs requests against the URLs returned by next, along with
+// their iteration numbers, until it reports the run is complete, pausing
+// between requests when a pause is configured.
+func runWorker(ctx context.Context, client *http.Client, cfg *Config, worker int, next func() (*url.URL, int, bool), summary *Summary) {
+	// Space out requests when a pause is configured.
+	pace := newPacer(cfg, worker)
+
+	// Perform requests until the run is complete.
+	for {
+		parsedURL, iteration, ok := next()
+		if !ok {
+			return
+		}
+
+		pace.started()
+		result := runCheck(ctx, client, cfg, parsedURL, iteration)
+		result.Weight = resultWeight(cfg.StatusWeights, result)
+		firstFailure := summary.record(result)
+		if cfg.OnResult != nil {
+			cfg.OnResult(result)
+		}
+
+		// Log each distinct failure once, leaving repeats to debug level and
+		// the roll-up at the end of the run.
+		if firstFailure {
+			log.WithFields(resultFields(cfg, parsedURL, result)).Errorln("Check failed:", result.Err)
+		} else if result.Err != nil {
+			log.WithFields(resultFields(cfg, parsedURL, result)).Debugln("Check failed again:", result.Err)
+		}
+
+		pace.wait(ctx)
+	}
+}
+
+// Result is the outcome of a single request.
+type Result struct {
+	// URL is the redacted URL that was queried.
+	URL string
+	// StatusCode is the response status, or zero when no response was received.
+	StatusCode int
+	// Duration is how long the request took to return response headers.
+	Duration time.Duration
+	// Timing holds the connection phase durations of the final attempt.
+	Timing ConnectionTiming
+	// Attempts is how many times the request was sent, including retries.
+	Attempts int
+	// ResponseHeaders holds the response headers of a failed check that got a
+	// response, with sensitive values redacted.
+	ResponseHeaders map[string]string
+	// BodySnippet holds the start of the response body of a failed check that
+	// got a response.
+	BodySnippet string
+	// Weight is the score the check earned toward the passing threshold.
+	Weight float64
+	// RotatedValue is the RotateHeader value the request was sent with.
+	RotatedValue string
+	// SuccessValue is the value found at SuccessJSONPath in a successful
+	// response.
+	SuccessValue string
+	// RequestBytes is the size of the request bodies sent, summed across
+	// attempts.
+	RequestBytes int64
+	// ResponseBytes is how many response body bytes were read off the
+	// connection, summed across attempts.
+	ResponseBytes int64
+	// ErrorCategory classifies the failure of a request that got no response.
+	ErrorCategory ErrorCategory
+	// Err describes why the check failed. A nil Err means the check passed.
+	Err error
+}
+
+// runCheck performs a single request and validates the response. iteration
+// numbers the request for the body template.
+func runCheck(ctx context.Context, client *http.Client, cfg *Config, parsedURL *url.URL, iteration int) (result Result) {
+	// Build the body and headers once so retries resend the same request.
+	result = Result{URL: cfg.RedactURL(parsedURL)}
+	payload, err := requestBody(cfg, iteration)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	headers := cfg.Headers
+	if len(cfg.RotateHeaderValues) != 0 {
+		result.RotatedValue = rotatedValue(cfg, iteration)
+		headers = make(map[string]string, len(cfg.Headers)+1)
+		for name, value := range cfg.Headers {
+			headers[name] = value
+		}
+		headers[cfg.RotateHeader] = result.RotatedValue
+	}
+
+	// Send the request, retrying connection-level errors and retryable
+	// statuses with backoff.
+	var request APIRequest
+	var response *http.Response
+	var responseBytes *countingReader
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		recorder := &TimingRecorder{}
+		requestURL := parsedURL
+		if cfg.CacheBust {
+			requestURL = cacheBustURL(parsedURL)
+		}
+		request = APIRequest{
+			URL:               requestURL,
+			Type:              cfg.RequestType,
+			Body:              payload,
+			Headers:           headers,
+			BearerToken:       cfg.BearerToken,
+			BasicAuthUsername: cfg.BasicAuthUsername,
+			BasicAuthPassword: cfg.BasicAuthPassword,
+			Cookies:           cfg.RequestCookies,
+			Timing:            recorder,
+			RedactQueryParams: cfg.RedactQueryParams,
+			Host:              cfg.HostOverride,
+			ContentType:       cfg.RequestContentType,
+			UserAgent:         cfg.UserAgent,
+			IfNoneMatch:       cfg.IfNoneMatch,
+		}
+		if cfg.Protocol == ProtocolGRPC {
+			request = grpcHealthAPIRequest(request, cfg.GRPCService)
+		}
+		if cfg.Protocol == ProtocolWebSocket {
+			request = webSocketAPIRequest(request)
+		}
+		notifyWait(cfg.OnWait, time.Duration(cfg.RequestTimeout)*time.Second)
+		response, err = CallAPI(ctx, client, request)
+		if request.Type != http.MethodGet && request.Type != http.MethodHead {
+			result.RequestBytes += int64(len(request.Body))
+		}
+		if err == nil {
+			responseBytes = countBody(response)
+		}
+		result.Duration = time.Since(start)
+		result.Timing = recorder.Timing()
+		result.Attempts = attempt + 1
+		log.WithFields(resultFields(cfg, parsedURL, result)).WithFields(log.Fields{
+			"dns_ms":     result.Timing.DNS.Milliseconds(),
+			"connect_ms": result.Timing.Connect.Milliseconds(),
+			"tls_ms":     result.Timing.TLSHandshake.Milliseconds(),
+			"ttfb_ms":    result.Timing.TTFB.Milliseconds(),
+		}).Debugln("Request timing")
+		retryStatus := err == nil && retryableStatus(cfg, response.StatusCode)
+		if (err == nil && !retryStatus) || attempt >= cfg.Retries || errors.Is(err, errTooManyRedirects) || ctx.Err() != nil {
+			break
+		}
+
+		// Release a retryable response before sending the next attempt, waiting
+		// as long as it asks when it says.
+		reason := fmt.Sprint(err)
+		delay := retryDelay(cfg.RetryBackoffMs, attempt)
+		if retryStatus {
+			reason = fmt.Sprintf("got a retryable %d", response.StatusCode)
+			after, ok := retryAfter(cfg, response, time.Now())
+			if ok {
+				delay = after
+			}
+			closeBody(response)
+			result.ResponseBytes += responseBytes.n
+		}
+		log.WithFields(resultFields(cfg, parsedURL, result)).WithFields(log.Fields{
+			"max_attempts": cfg.Retries + 1,
+			"retry_in_ms":  delay.Milliseconds(),
+		}).Debugln("Attempt failed, retrying:", reason)
+		notifyWait(cfg.OnWait, delay)
+		sleepContext(ctx, delay)
+	}
+	if err != nil {
+		result.ErrorCategory = classifyError(err, ctx.Err())
+		if ctx.Err() != nil {
+			result.Err = fmt.Errorf("request to %s was cancelled: %w", cfg.RedactURL(parsedURL), ctx.Err())
+			return result
+		}
+		if isDialTimeout(err) {
+			result.Err = fmt.Errorf("connecting to %s timed out after %s", cfg.RedactURL(parsedURL), dialTimeout(cfg))
+			return result
+		}
+		if isTimeout(err) {
+			result.Err = fmt.Errorf("request to %s timed out after %d seconds", cfg.RedactURL(parsedURL), cfg.RequestTimeout)
+			return result
+		}
+		result.Err = fmt.Errorf("failed to reach URL %s: %w", cfg.RedactURL(parsedURL), err)
+		return result
+	}
+	defer func() {
+		closeBody(response)
+		result.ResponseBytes += responseBytes.n
+	}()
+	result.StatusCode = response.StatusCode
+	logResponseMetadata(resultFields(cfg, parsedURL, result), response)
+
+	// Validate the response, keeping an example of what a failure looked like.
+	body := newCachedBody(cfg, response)
+	switch cfg.Protocol {
+	case ProtocolGRPC:
+		result.Err = validateGRPCResponse(cfg, parsedURL, response, body)
+	case ProtocolWebSocket:
+		result.Err = validateWebSocket(ctx, cfg, parsedURL, response)
+		if errors.Is(result.Err, errWebSocketHandshake) {
+			result.ErrorCategory = CategoryWebSocketHandshake
+		}
+	default:
+		result.Err = validateResponse(cfg, parsedURL, response, body, result)
+	}
+
+	// Repeat a passing request when idempotency is verified.
+	if result.Err == nil && len(cfg.IdempotencyCheck) != 0 {
+		result.Err = verifyIdempotent(ctx, client, cfg, parsedURL, request, response, body, &result)
+	}
+	if result.Err != nil {
+		data, _ := body.read()
+		result.ResponseHeaders = redactResponseHeaders(response.Header)
+		result.BodySnippet = bodySnippet(data)
+		return result
+	}
+
+	// Extract the success value when configured. A missing value never fails
+	// the check.
+	if len(cfg.SuccessJSONPath) != 0 {
+		result.SuccessValue, err = extractSuccessValue(cfg, body)
+		if err != nil {
+			log.WithFields(resultFields(cfg, parsedURL, result)).Debugln("No success value:", err)
+		}
+	}
+
+	fields := resultFields(cfg, parsedURL, result)
+	fields["protocol"] = response.Proto
+	if body.done && len(body.data) != 0 {
+		fields["wire_bytes"] = body.wireBytes
+		fields["body_bytes"] = len(body.data)
+	}
+	if response.TLS != nil {
+		fields["tls_version"] = tls.VersionName(response.TLS.Version)
+	}
+	log.WithFields(fields).Infoln("Request succeeded")
+	return result
+}
+
+// rotatedValue returns the RotateHeader value for the request numbered
+// iteration. Requests rotate through the URLs first, so the value advances
+// once per round of URLs and every URL sees every value. Warm-up requests use
+// the first value.
+func rotatedValue(cfg *Config, iteration int) string {
+	// Count the rounds completed before this request.
+	if iteration < 1 {
+		return cfg.RotateHeaderValues[0]
+	}
+	round := (iteration - 1) / max(len(cfg.CheckURLs), 1)
+
+	return cfg.RotateHeaderValues[round%len(cfg.RotateHeaderValues)]
+}
+
+// retryableStatus reports whether a response with statusCode should be retried.
+// A status that already passes is never retried.
+func retryableStatus(cfg *Config, statusCode int) bool {
+	// Only retry statuses that were listed and would otherwise fail.
+	if cfg.RetryOnStatus == nil || cfg.ExpectedStatus.Matches(statusCode) {
+		return false
+	}
+
+	return cfg.RetryOnStatus.Matches(statusCode)
+}
+
+// retryAfter returns the wait requested by the Retry-After header of a 429 or
+// 503 response, as delay seconds or an HTTP date, capped at
+// MaxRetryAfterSeconds. It reports false when there is no usable header or
+// the header is ignored.
+func retryAfter(cfg *Config, response *http.Response, now time.Time) (time.Duration, bool) {
+	// Only honor the header where it describes recovery time.
+	if cfg.MaxRetryAfterSeconds <= 0 {
+		return 0, false
+	}
+	if response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	header := strings.TrimSpace(response.Header.Get("Retry-After"))
+	if len(header) == 0 {
+		return 0, false
+	}
+
+	// Parse either form. A date in the past means retry right away.
+	limit := time.Duration(cfg.MaxRetryAfterSeconds) * time.Second
+	seconds, err := strconv.Atoi(header)
+	if err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(min(seconds, cfg.MaxRetryAfterSeconds)) * time.Second, true
+	}
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+
+	return min(max(date.Sub(now), 0), limit), true
+}
+
+// retryDelay returns the exponential backoff delay before the retry that
+// follows the given zero-based attempt.
+func retryDelay(backoffMs int, attempt int) time.Duration {
+	// Double the base delay for every prior retry, capping the exponent so the
+	// shift cannot overflow.
+	if attempt > 16 {
+		attempt = 16
+	}
+	return time.Duration(backoffMs) * time.Millisecond << attempt
+}
+
+// validateResponse applies every configured assertion to a response.
+func validateResponse(cfg *Config, parsedURL *url.URL, response *http.Response, body *cachedBody, result Result) error {
+	// Validate the status code.
+	if !cfg.ExpectedStatus.Matches(response.StatusCode) {
+		return fmt.Errorf("got a %d with a %s to %s", response.StatusCode, cfg.RequestType, cfg.RedactURL(parsedURL))
+	}
+
+	// Validate the response headers.
+	err := validateHeaders(cfg.ExpectedResponseHeaders, response.Header)
+	if err != nil {
+		return fmt.Errorf("%s to %s %w", cfg.RequestType, cfg.RedactURL(parsedURL), err)
+	}
+	err = validateForbiddenHeaders(cfg.ForbiddenResponseHeaders, response.Header)
+	if err != nil {
+		return fmt.Errorf("%s to %s %w", cfg.RequestType, cfg.RedactURL(parsedURL), err)
+	}
+
+	// Validate where the request landed.
+	err = validateFinalURL(cfg, response)
+	if err != nil {
+		return fmt.Errorf("%s to %s %w", cfg.RequestType, cfg.RedactURL(parsedURL), err)
+	}
+
+	// Validate the content encoding.
+	if len(cfg.ExpectedContentEncoding) != 0 {
+		contentEncoding := response.Header.Get("Content-Encoding")
+		if !strings.EqualFold(contentEncoding, cfg.ExpectedContentEncoding) {
+			return fmt.Errorf("%s to %s returned Content-Encoding %q, expected %q", cfg.RequestType, cfg.RedactURL(parsedURL), contentEncoding, cfg.ExpectedContentEncoding)
+		}
+	}
+
+	// Validate the negotiated protocol.
+	if cfg.RequireHTTP2 && response.ProtoMajor < 2 {
+		return fmt.Errorf("%s to %s negotiated %s instead of HTTP/2", cfg.RequestType, cfg.RedactURL(parsedURL), response.Proto)
+	}
+
+	// Validate the negotiated TLS version.
+	if cfg.AssertMinTLSVersion && cfg.MinTLSVersion != 0 {
+		if response.TLS == nil {
+			return fmt.Errorf("%s to %s was not served over TLS, expected at least %s", cfg.RequestType, cfg.RedactURL(parsedURL), tls.VersionName(cfg.MinTLSVersion))
+		}
+		if response.TLS.Version < cfg.MinTLSVersion {
+			return fmt.Errorf("%s to %s negotiated %s, expected at least %s", cfg.RequestType, cfg.RedactURL(parsedURL), tls.VersionName(response.TLS.Version), tls.VersionName(cfg.MinTLSVersion))
+		}
+	}
+
+	// Validate the server certificate expiry.
+	err = checkCertExpiry(cfg, parsedURL, response)
+	if err != nil {
+		return err
+	}
+
+	// Validate the response time.
+	maxResponseTime := time.Duration(cfg.MaxResponseTimeMs) * time.Millisecond
+	if maxResponseTime > 0 && result.Duration > maxResponseTime {
+		return fmt.Errorf("%s to %s took %dms, exceeding the allowed %dms", cfg.RequestType, cfg.RedactURL(parsedURL), result.Duration.Milliseconds(), cfg.MaxResponseTimeMs)
+	}
+
+	// Validate the DNS lookup time.
+	maxDNSTime := time.Duration(cfg.MaxDNSTimeMs) * time.Millisecond
+	if maxDNSTime > 0 && result.Timing.DNS > maxDNSTime {
+		return fmt.Errorf("DNS lookup for %s took %dms, exceeding the allowed %dms", cfg.RedactURL(parsedURL), result.Timing.DNS.Milliseconds(), cfg.MaxDNSTimeMs)
+	}
+
+	// Validate the time to first byte.
+	maxTTFB := time.Duration(cfg.MaxTTFBMs) * time.Millisecond
+	if maxTTFB > 0 && result.Timing.TTFB > maxTTFB {
+		return fmt.Errorf("first byte from %s took %dms, exceeding the allowed %dms", cfg.RedactURL(parsedURL), result.Timing.TTFB.Milliseconds(), cfg.MaxTTFBMs)
+	}
+
+	// Validate the compression ratio.
+	if cfg.MinCompressionRatio > 0 {
+		err := validateCompressionRatio(cfg, response, body)
+		if err != nil {
+			return fmt.Errorf("response body from %s %w", cfg.RedactURL(parsedURL), err)
+		}
+	}
+
+	// Read a streamed body only until the expected line arrives.
+	if len(cfg.ExpectedStreamLine) != 0 {
+		found, err := body.readStream(cfg.ExpectedStreamLine)
+		switch {
+		case found:
+			return nil
+		case isTimeout(err):
+			return fmt.Errorf("stream from %s did not send the line %q within %d seconds", cfg.RedactURL(parsedURL), cfg.ExpectedStreamLine, cfg.RequestTimeout)
+		case err == io.EOF:
+			return fmt.Errorf("stream from %s ended without the line %q", cfg.RedactURL(parsedURL), cfg.ExpectedStreamLine)
+		case errors.Is(err, errBodyTooLarge):
+			return fmt.Errorf("stream from %s did not send the line %q in its first %d bytes", cfg.RedactURL(parsedURL), cfg.ExpectedStreamLine, body.limit)
+		default:
+			return fmt.Errorf("error reading the stream from %s while waiting for the line %q: %w", cfg.RedactURL(parsedURL), cfg.ExpectedStreamLine, err)
+		}
+	}
+
+	// Validate the body when an assertion is configured.
+	if cfg.hasBodyAssertions() {
+		data, err := body.read()
+		if err != nil {
+			return fmt.Errorf("error reading response body from %s: %w", cfg.RedactURL(parsedURL), err)
+		}
+		err = validateBody(cfg, data)
+		if err != nil {
+			return fmt.Errorf("response body from %s %w", cfg.RedactURL(parsedURL), err)
+		}
+	}
+
+	return nil
+}
+
+// checkCertExpiry reports a server certificate that expires within
+// cfg.CertExpiryWarningDays, as an error when cfg.CertExpiryFail is set and as
+// a warning otherwise.
+func checkCertExpiry(cfg *Config, parsedURL *url.URL, response *http.Response) error {
+	// Skip when disabled or when no certificate was presented.
+	if cfg.CertExpiryWarningDays == 0 || response.TLS == nil || len(response.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+
+	// Compare the leaf certificate expiry against the window. AddDate avoids
+	// overflowing time.Duration for long windows.
+	notAfter := response.TLS.PeerCertificates[0].NotAfter
+	now := time.Now()
+	if notAfter.After(now.AddDate(0, 0, cfg.CertExpiryWarningDays)) {
+		return nil
+	}
+	message := fmt.Sprintf("certificate for %s expires at %s, within %d days", cfg.RedactURL(parsedURL), notAfter.UTC().Format(time.RFC3339), cfg.CertExpiryWarningDays)
+	if !notAfter.After(now) {
+		message = fmt.Sprintf("certificate for %s expired at %s", cfg.RedactURL(parsedURL), notAfter.UTC().Format(time.RFC3339))
+	}
+	if cfg.CertExpiryFail {
+		return errors.New(message)
+	}
+	log.WithFields(requestFields(cfg, parsedURL)).Warnln(message)
+
+	return nil
+}
+
+// notifyWait calls onWait, when set, before a wait of up to delay.
+func notifyWait(onWait func(delay time.Duration), delay time.Duration) {
+	// Skip waits that do not block.
+	if onWait == nil || delay <= 0 {
+		return
+	}
+	onWait(delay)
+}
+
+// sleepContext pauses for delay, returning early when ctx is done.
+func sleepContext(ctx context.Context, delay time.Duration) {
+	// Wait on a timer so cancellation is not delayed.
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// CallAPI performs an API call on the basis of the request type, body, and URL.
+// The request is cancelled when ctx is done.
+func CallAPI(ctx context.Context, client *http.Client, request APIRequest) (*http.Response, error) {
+	// Do not start a request once ctx is done.
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("error occurred while calling %s: %w", RedactURL(request.URL, request.RedactQueryParams), ctx.Err())
+	}
+
+	// GET and HEAD requests never send a body. A bytes.Reader lets the client
+	// rewind the body through GetBody when it needs to resend it.
+	var body io.Reader
+	if request.Type != http.MethodGet && request.Type != http.MethodHead {
+		body = bytes.NewReader(request.Body)
+	}
+
+	// Trace connection phases when requested.
+	if request.Timing != nil {
+		ctx = withTiming(ctx, request.Timing)
+	}
+
+	// Build the request and apply configured headers.
+	req, err := http.NewRequestWithContext(ctx, request.Type, request.URL.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred while calling %s: %w", RedactURL(request.URL, request.RedactQueryParams), redactError(err, request.RedactQueryParams))
+	}
+	if body != nil && len(request.ContentType) != 0 {
+		req.Header.Set("Content-Type", request.ContentType)
+	}
+	if len(request.UserAgent) != 0 {
+		req.Header.Set("User-Agent", request.UserAgent)
+	}
+	if len(request.IfNoneMatch) != 0 {
+		req.Header.Set("If-None-Match", request.IfNoneMatch)
+	}
+	for key, value := range request.Headers {
+		req.Header.Set(key, value)
+	}
+	if len(request.Host) != 0 {
+		req.Host = request.Host
+	}
+	if len(request.BearerToken) != 0 {
+		req.Header.Set("Authorization", "Bearer "+request.BearerToken)
+	}
+	if len(request.BasicAuthUsername) != 0 && len(request.BasicAuthPassword) != 0 {
+		req.SetBasicAuth(request.BasicAuthUsername, request.BasicAuthPassword)
+	}
+	for _, cookie := range request.Cookies {
+		req.AddCookie(cookie)
+	}
+
+	// Send the request.
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error occurred while calling %s: %w", RedactURL(request.URL, request.RedactQueryParams), redactError(err, request.RedactQueryParams))
+	}
+	return response, nil
+}
+
+// PassingThreshold returns how many of totalChecks must pass to satisfy
+// passingPercent. Fractional results are rounded up so the bar is never
+// lowered, for example 90 percent of 7 checks requires 7 rather than 6.
+func PassingThreshold(passingPercent int, totalChecks int) int {
+	// Integer ceiling division avoids floating point error.
+	return (passingPercent*totalChecks + 99) / 100
+}
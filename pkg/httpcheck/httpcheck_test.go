@@ -0,0 +1,600 @@
+package httpcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TestMain silences the check logs so test output stays readable.
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// mustParseURL parses raw or fails the test.
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("error parsing %q: %v", raw, err)
+	}
+	return parsed
+}
+
+// newTestConfig returns the default config checking rawURL once.
+func newTestConfig(t *testing.T, rawURL string) *Config {
+	t.Helper()
+	cfg := NewConfig()
+	cfg.CheckURLs = []*url.URL{mustParseURL(t, rawURL)}
+	cfg.RetryBackoffMs = 1
+	return cfg
+}
+
+// runTestConfig runs the check and fails the test when Run returns an error.
+func runTestConfig(t *testing.T, cfg *Config) *Summary {
+	t.Helper()
+	summary, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Run returned an error: %v", err)
+	}
+	return summary
+}
+
+// connCounter tracks the connections a test server accepts.
+type connCounter struct {
+	// mu guards the counts.
+	mu sync.Mutex
+	// opened is how many connections were accepted.
+	opened int
+	// open is how many connections are currently open.
+	open int
+	// maxOpen is the most connections open at once.
+	maxOpen int
+}
+
+// track records a connection state change.
+func (c *connCounter) track(_ net.Conn, state http.ConnState) {
+	// Count new connections and those that went away.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch state {
+	case http.StateNew:
+		c.opened++
+		c.open++
+		c.maxOpen = max(c.maxOpen, c.open)
+	case http.StateClosed, http.StateHijacked:
+		c.open--
+	}
+}
+
+// TestRunClosesResponseBodies runs many checks whose bodies are never read
+// and requires the connection to be reused, which only happens when every
+// body is drained and closed.
+func TestRunClosesResponseBodies(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "passing", status: http.StatusOK, body: strings.Repeat("a", 64<<10)},
+		{name: "wrong status", status: http.StatusInternalServerError, body: strings.Repeat("b", 64<<10)},
+		{name: "empty body", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Serve a large body that the check does not need to read.
+			counter := &connCounter{}
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(test.status)
+				_, _ = io.WriteString(w, test.body)
+			}))
+			server.Config.ConnState = counter.track
+			server.Start()
+			defer server.Close()
+
+			cfg := NewConfig()
+			cfg.CheckURLs = []*url.URL{mustParseURL(t, server.URL)}
+			cfg.Count = 200
+			cfg.PassingPercent = 0
+			summary, err := Run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Run returned an error: %v", err)
+			}
+			if summary.ChecksRan != cfg.Count {
+				t.Fatalf("ran %d checks, want %d", summary.ChecksRan, cfg.Count)
+			}
+
+			// One worker should keep reusing a single connection.
+			counter.mu.Lock()
+			defer counter.mu.Unlock()
+			if counter.maxOpen > cfg.Concurrency {
+				t.Errorf("%d connections were open at once, want at most %d", counter.maxOpen, cfg.Concurrency)
+			}
+			if counter.opened > 2 {
+				t.Errorf("%d connections were opened for %d checks, want the connection reused", counter.opened, cfg.Count)
+			}
+		})
+	}
+}
+
+// bodyRecorder is a test handler that records every request body it receives
+// and fails the first failFirst requests with a 503.
+type bodyRecorder struct {
+	// mu guards bodies.
+	mu sync.Mutex
+	// bodies holds the received request bodies in order.
+	bodies []string
+	// failFirst is how many requests get a 503 before the rest pass.
+	failFirst int
+}
+
+// ServeHTTP records the request body and answers it.
+func (b *bodyRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Record the body before deciding the status.
+	data, _ := io.ReadAll(r.Body)
+	b.mu.Lock()
+	b.bodies = append(b.bodies, string(data))
+	failing := len(b.bodies) <= b.failFirst
+	b.mu.Unlock()
+	if failing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// TestRunResendsRequestBody checks every request and every retry carries
+// the full body.
+func TestRunResendsRequestBody(t *testing.T) {
+	body := `{"name":"http-check","padding":"` + strings.Repeat("x", 4096) + `"}`
+	tests := []struct {
+		name       string
+		count      int
+		retries    int
+		failFirst  int
+		wantBodies int
+	}{
+		{name: "repeated requests", count: 3, wantBodies: 3},
+		{name: "retried requests", count: 3, retries: 2, failFirst: 2, wantBodies: 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &bodyRecorder{failFirst: test.failFirst}
+			server := httptest.NewServer(recorder)
+			defer server.Close()
+
+			cfg := newTestConfig(t, server.URL)
+			cfg.Count = test.count
+			cfg.RequestType = http.MethodPost
+			cfg.RequestBody = body
+			cfg.Retries = test.retries
+			cfg.RetryOnStatus = NewStatusMatcher(http.StatusServiceUnavailable)
+			summary := runTestConfig(t, cfg)
+			if summary.ChecksPassed != test.count {
+				t.Errorf("%d of %d checks passed, failures: %v", summary.ChecksPassed, test.count, summary.FailureMessages())
+			}
+
+			// Every attempt must have sent the whole body.
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			if len(recorder.bodies) != test.wantBodies {
+				t.Fatalf("server received %d requests, want %d", len(recorder.bodies), test.wantBodies)
+			}
+			for i, received := range recorder.bodies {
+				if received != body {
+					t.Errorf("request %d sent a %d byte body, want %d bytes", i+1, len(received), len(body))
+				}
+			}
+		})
+	}
+}
+
+// TestRunConcurrentCounters runs many workers against a server that fails
+// every fourth request and checks no result is lost or counted twice. Run it
+// with -race to check the shared counters.
+func TestRunConcurrentCounters(t *testing.T) {
+	// Fail a fixed share of requests, tracking how many overlap.
+	var served, inFlight, maxInFlight atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+		if served.Add(1)%4 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		concurrency int
+		count       int
+		urls        int
+	}{
+		{name: "one worker", concurrency: 1, count: 20, urls: 1},
+		{name: "more workers than requests", concurrency: 16, count: 3, urls: 2},
+		{name: "many workers", concurrency: 8, count: 100, urls: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			served.Store(0)
+			maxInFlight.Store(0)
+			cfg := newTestConfig(t, server.URL)
+			for i := 1; i < test.urls; i++ {
+				cfg.CheckURLs = append(cfg.CheckURLs, mustParseURL(t, server.URL+"/"+strconv.Itoa(i)))
+			}
+			cfg.Count = test.count
+			cfg.Concurrency = test.concurrency
+			cfg.PassingPercent = 0
+			var callbacks atomic.Int64
+			cfg.OnResult = func(Result) {
+				callbacks.Add(1)
+			}
+			summary := runTestConfig(t, cfg)
+
+			// Every request is counted exactly once.
+			total := test.count * test.urls
+			if summary.ChecksRan != total || int(served.Load()) != total || int(callbacks.Load()) != total {
+				t.Fatalf("ran %d checks, served %d, got %d results, want %d of each", summary.ChecksRan, served.Load(), callbacks.Load(), total)
+			}
+			if summary.ChecksFailed != total/4 || summary.ChecksPassed != total-total/4 {
+				t.Errorf("%d passed and %d failed, want %d and %d", summary.ChecksPassed, summary.ChecksFailed, total-total/4, total/4)
+			}
+			for redactedURL, perURL := range summary.URLResults {
+				if perURL.ChecksRan != test.count {
+					t.Errorf("%s ran %d checks, want %d", redactedURL, perURL.ChecksRan, test.count)
+				}
+			}
+			if maxInFlight.Load() > int64(test.concurrency) {
+				t.Errorf("%d requests were in flight at once, want at most %d", maxInFlight.Load(), test.concurrency)
+			}
+			if test.concurrency > 1 && total > 1 && maxInFlight.Load() < 2 {
+				t.Errorf("requests never overlapped with %d workers", test.concurrency)
+			}
+		})
+	}
+}
+
+// TestCallAPICancel checks CallAPI gives up promptly with a context error
+// once its context is cancelled.
+func TestCallAPICancel(t *testing.T) {
+	// Hold every request open until the test ends.
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	tests := []struct {
+		name string
+		// cancelAfterStart cancels once the server has the request instead of
+		// before it is sent.
+		cancelAfterStart bool
+	}{
+		{name: "cancelled before sending"},
+		{name: "cancelled mid-request", cancelAfterStart: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if !test.cancelAfterStart {
+				cancel()
+			} else {
+				go func() {
+					<-started
+					cancel()
+				}()
+			}
+
+			start := time.Now()
+			request := APIRequest{URL: mustParseURL(t, server.URL), Type: http.MethodGet}
+			response, err := CallAPI(ctx, server.Client(), request)
+			if err == nil {
+				response.Body.Close()
+				t.Fatal("CallAPI returned a response, want a context error")
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("CallAPI error = %v, want context.Canceled", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("CallAPI took %s to return after cancellation", elapsed)
+			}
+		})
+	}
+}
+
+// TestRunInterrupted checks a run cancelled mid-request stops and returns
+// ErrInterrupted with the partial summary.
+func TestRunInterrupted(t *testing.T) {
+	// Cancel the run once the first request reaches the server.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(t, server.URL)
+	cfg.Count = 5
+	start := time.Now()
+	summary, err := Run(ctx, cfg)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("Run error = %v, want ErrInterrupted", err)
+	}
+	if summary.ChecksRan != 1 || summary.ChecksPassed != 0 {
+		t.Errorf("ran %d checks with %d passing, want the one cancelled check", summary.ChecksRan, summary.ChecksPassed)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %s to return after cancellation", elapsed)
+	}
+}
+
+// TestPassingThreshold checks the required pass count is rounded up so the
+// bar is never lowered.
+func TestPassingThreshold(t *testing.T) {
+	tests := []struct {
+		name           string
+		passingPercent int
+		totalChecks    int
+		want           int
+	}{
+		{name: "no checks", passingPercent: 100, totalChecks: 0, want: 0},
+		{name: "no checks at zero percent", passingPercent: 0, totalChecks: 0, want: 0},
+		{name: "zero percent", passingPercent: 0, totalChecks: 10, want: 0},
+		{name: "all of one", passingPercent: 100, totalChecks: 1, want: 1},
+		{name: "all of three", passingPercent: 100, totalChecks: 3, want: 3},
+		{name: "exact fraction", passingPercent: 50, totalChecks: 10, want: 5},
+		{name: "fraction rounds up", passingPercent: 90, totalChecks: 7, want: 7},
+		{name: "small fraction rounds up", passingPercent: 1, totalChecks: 7, want: 1},
+		{name: "half of odd count", passingPercent: 50, totalChecks: 3, want: 2},
+		{name: "just below a whole check", passingPercent: 99, totalChecks: 100, want: 99},
+		{name: "just above a whole check", passingPercent: 34, totalChecks: 3, want: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := PassingThreshold(test.passingPercent, test.totalChecks)
+			if got != test.want {
+				t.Errorf("PassingThreshold(%d, %d) = %d, want %d", test.passingPercent, test.totalChecks, got, test.want)
+			}
+		})
+	}
+}
+
+// TestUserAgent checks the versioned default User-Agent is sent unless the
+// config or a custom header replaces it.
+func TestUserAgent(t *testing.T) {
+	// Record the User-Agent of each request.
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("User-Agent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	if NewConfig().UserAgent != DefaultUserAgent {
+		t.Fatalf("NewConfig UserAgent = %q, want %q", NewConfig().UserAgent, DefaultUserAgent)
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		headers   map[string]string
+		want      string
+	}{
+		{name: "default", userAgent: DefaultUserAgent, want: "kuberhealthy-http-check/dev"},
+		{name: "configured", userAgent: "probe/1.0", want: "probe/1.0"},
+		{name: "custom header wins", userAgent: DefaultUserAgent, headers: map[string]string{"User-Agent": "header/2.0"}, want: "header/2.0"},
+		{name: "empty keeps the Go default", userAgent: "", want: "Go-http-client/1.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newTestConfig(t, server.URL)
+			cfg.UserAgent = test.userAgent
+			cfg.Headers = test.headers
+			runTestConfig(t, cfg)
+			got := <-received
+			if got != test.want {
+				t.Errorf("User-Agent = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestRetryDelay checks the backoff doubles with every attempt and the shift
+// is capped.
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		backoffMs int
+		attempt   int
+		want      time.Duration
+	}{
+		{name: "first retry", backoffMs: 500, attempt: 0, want: 500 * time.Millisecond},
+		{name: "second retry", backoffMs: 500, attempt: 1, want: time.Second},
+		{name: "fourth retry", backoffMs: 100, attempt: 3, want: 800 * time.Millisecond},
+		{name: "no backoff", backoffMs: 0, attempt: 5, want: 0},
+		{name: "capped shift", backoffMs: 1, attempt: 40, want: time.Millisecond << 16},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := retryDelay(test.backoffMs, test.attempt)
+			if got != test.want {
+				t.Errorf("retryDelay(%d, %d) = %s, want %s", test.backoffMs, test.attempt, got, test.want)
+			}
+		})
+	}
+}
+
+// TestRetryAfter checks Retry-After is honored in both forms on 429 and 503
+// responses, capped at MaxRetryAfterSeconds.
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name       string
+		status     int
+		header     string
+		maxSeconds int
+		want       time.Duration
+		wantOK     bool
+	}{
+		{name: "seconds", status: http.StatusServiceUnavailable, header: "3", maxSeconds: 10, want: 3 * time.Second, wantOK: true},
+		{name: "seconds on 429", status: http.StatusTooManyRequests, header: " 2 ", maxSeconds: 10, want: 2 * time.Second, wantOK: true},
+		{name: "seconds capped", status: http.StatusServiceUnavailable, header: "120", maxSeconds: 10, want: 10 * time.Second, wantOK: true},
+		{name: "zero seconds", status: http.StatusServiceUnavailable, header: "0", maxSeconds: 10, want: 0, wantOK: true},
+		{name: "date", status: http.StatusServiceUnavailable, header: now.Add(5 * time.Second).Format(http.TimeFormat), maxSeconds: 10, want: 5 * time.Second, wantOK: true},
+		{name: "date capped", status: http.StatusServiceUnavailable, header: now.Add(time.Hour).Format(http.TimeFormat), maxSeconds: 10, want: 10 * time.Second, wantOK: true},
+		{name: "date in the past", status: http.StatusServiceUnavailable, header: now.Add(-time.Hour).Format(http.TimeFormat), maxSeconds: 10, want: 0, wantOK: true},
+		{name: "negative seconds", status: http.StatusServiceUnavailable, header: "-1", maxSeconds: 10},
+		{name: "malformed", status: http.StatusServiceUnavailable, header: "soon", maxSeconds: 10},
+		{name: "missing", status: http.StatusServiceUnavailable, maxSeconds: 10},
+		{name: "other status", status: http.StatusInternalServerError, header: "3", maxSeconds: 10},
+		{name: "disabled", status: http.StatusServiceUnavailable, header: "3", maxSeconds: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.MaxRetryAfterSeconds = test.maxSeconds
+			response := &http.Response{StatusCode: test.status, Header: http.Header{}}
+			if len(test.header) != 0 {
+				response.Header.Set("Retry-After", test.header)
+			}
+			got, ok := retryAfter(cfg, response, now)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("retryAfter = %s, %v, want %s, %v", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+// TestRunOnWait checks OnWait hears about every request attempt, retry
+// backoff, and pacing pause before it blocks, so a liveness probe can cover
+// waits longer than its allowed age.
+func TestRunOnWait(t *testing.T) {
+	// Drop the first connection so the request is retried once.
+	var served atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if served.Add(1) == 1 {
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig(t, server.URL)
+	cfg.Retries = 1
+	cfg.RetryBackoffMs = 10
+	cfg.RequestTimeout = 5
+	cfg.Seconds = 1
+	var mu sync.Mutex
+	var waits []time.Duration
+	cfg.OnWait = func(delay time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		waits = append(waits, delay)
+	}
+	summary := runTestConfig(t, cfg)
+	if !summary.Passed(cfg, cfg.Count) {
+		t.Fatalf("check failed: %v", summary.FailureMessages())
+	}
+
+	// Expect both attempts, the backoff between them, and the pacing pause.
+	mu.Lock()
+	defer mu.Unlock()
+	if len(waits) != 4 {
+		t.Fatalf("OnWait calls = %v, want 4", waits)
+	}
+	if waits[0] != 5*time.Second || waits[1] != 10*time.Millisecond || waits[2] != 5*time.Second {
+		t.Errorf("OnWait calls = %v, want the request timeout, the backoff, and the request timeout", waits)
+	}
+	if waits[3] <= 0 || waits[3] > time.Second {
+		t.Errorf("pacing pause = %s, want at most 1s", waits[3])
+	}
+}
+
+// TestRunRetriesTransportErrors checks dropped connections are retried up to
+// Retries times with backoff between attempts.
+func TestRunRetriesTransportErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      int
+		dropFirst    int64
+		wantPass     bool
+		wantAttempts int
+		// minElapsed is the least time the backoff must have waited.
+		minElapsed time.Duration
+	}{
+		{name: "no retries", retries: 0, dropFirst: 1, wantPass: false, wantAttempts: 1},
+		{name: "recovers", retries: 2, dropFirst: 2, wantPass: true, wantAttempts: 3, minElapsed: 30 * time.Millisecond},
+		{name: "retries exhausted", retries: 2, dropFirst: 3, wantPass: false, wantAttempts: 3, minElapsed: 30 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Close the connection without a response for the first requests.
+			var served atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if served.Add(1) <= test.dropFirst {
+					conn, _, err := http.NewResponseController(w).Hijack()
+					if err == nil {
+						_ = conn.Close()
+					}
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			cfg := newTestConfig(t, server.URL)
+			cfg.Retries = test.retries
+			cfg.RetryBackoffMs = 10
+			var attempts int
+			cfg.OnResult = func(result Result) {
+				attempts = result.Attempts
+			}
+			start := time.Now()
+			summary := runTestConfig(t, cfg)
+			elapsed := time.Since(start)
+			if summary.Passed(cfg, cfg.Count) != test.wantPass {
+				t.Errorf("passed = %v, want %v, failures: %v", !test.wantPass, test.wantPass, summary.FailureMessages())
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", attempts, test.wantAttempts)
+			}
+			if elapsed < test.minElapsed {
+				t.Errorf("run took %s, want at least %s of backoff", elapsed, test.minElapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package httpcheck
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// verifyIdempotent sends request again and compares the repeat with the
+// response to the first send, whose body has not been closed yet. The bytes
+// the repeat moved are added to result.
+func verifyIdempotent(ctx context.Context, client *http.Client, cfg *Config, parsedURL *url.URL, request APIRequest, response *http.Response, body *cachedBody, result *Result) error {
+	// Repeat the exact request.
+	repeat, err := CallAPI(ctx, client, request)
+	if request.Type != http.MethodGet && request.Type != http.MethodHead {
+		result.RequestBytes += int64(len(request.Body))
+	}
+	if err != nil {
+		return fmt.Errorf("idempotency check of %s could not repeat the %s: %w", cfg.RedactURL(parsedURL), request.Type, err)
+	}
+	repeatBytes := countBody(repeat)
+	defer func() {
+		closeBody(repeat)
+		result.ResponseBytes += repeatBytes.n
+	}()
+
+	// Compare the status codes.
+	if repeat.StatusCode != response.StatusCode {
+		return fmt.Errorf("idempotency check of %s failed: repeating the %s got a %d after a %d", cfg.RedactURL(parsedURL), request.Type, repeat.StatusCode, response.StatusCode)
+	}
+	if cfg.IdempotencyCheck != IdempotencyBody {
+		return nil
+	}
+
+	// Compare the bodies, up to the body limit.
+	first, err := body.read()
+	if err != nil {
+		return fmt.Errorf("error reading response body from %s: %w", cfg.RedactURL(parsedURL), err)
+	}
+	second, err := newCachedBody(cfg, repeat).read()
+	if err != nil {
+		return fmt.Errorf("error reading the repeated response body from %s: %w", cfg.RedactURL(parsedURL), err)
+	}
+	if !bytes.Equal(first, second) {
+		return fmt.Errorf("idempotency check of %s failed: repeating the %s returned a different body: %s", cfg.RedactURL(parsedURL), request.Type, bodySnippet(second))
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package httpcheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookupJSONPath decodes body as JSON and returns the value at the dotted path,
+// such as "data.status". Numeric segments index into arrays, such as
+// "items.0.name".
+func lookupJSONPath(body []byte, path string) (any, error) {
+	// Decode numbers as json.Number so they keep their original text.
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, fmt.Errorf("is not valid JSON: %w", err)
+	}
+
+	// Walk each path segment.
+	walked := []string{}
+	for _, segment := range strings.Split(path, ".") {
+		walked = append(walked, segment)
+		switch node := value.(type) {
+		case map[string]any:
+			child, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("has no value at JSON path %q", strings.Join(walked, "."))
+			}
+			value = child
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("has no value at JSON path %q", strings.Join(walked, "."))
+			}
+			value = node[index]
+		default:
+			return nil, fmt.Errorf("has no value at JSON path %q", strings.Join(walked, "."))
+		}
+	}
+
+	return value, nil
+}
+
+// formatJSONValue renders a decoded JSON value for comparison. Strings are
+// returned as-is and everything else is rendered as compact JSON.
+func formatJSONValue(value any) string {
+	// Compare strings without their quotes.
+	text, ok := value.(string)
+	if ok {
+		return text
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,44 @@
+package httpcheck
+
+import "testing"
+
+// TestValidateBodyJSONPath checks dotted paths walk objects and arrays and the
+// value found is compared in its original text.
+func TestValidateBodyJSONPath(t *testing.T) {
+	body := `{"status":"ok","data":{"ready":true,"replicas":3,"ratio":0.50,"owner":null,"items":[{"name":"a"},{"name":"b"}]}}`
+	tests := []struct {
+		name    string
+		path    string
+		value   string
+		body    string
+		wantErr string
+	}{
+		{name: "top level exists", path: "status"},
+		{name: "top level value", path: "status", value: "ok"},
+		{name: "nested boolean", path: "data.ready", value: "true"},
+		{name: "number keeps its text", path: "data.ratio", value: "0.50"},
+		{name: "integer", path: "data.replicas", value: "3"},
+		{name: "null", path: "data.owner", value: "null"},
+		{name: "array index", path: "data.items.1.name", value: "b"},
+		{name: "object value", path: "data.items.0", value: `{"name":"a"}`},
+		{name: "wrong value", path: "status", value: "degraded", wantErr: `has "ok" at JSON path "status", expected "degraded"`},
+		{name: "missing member", path: "data.missing", wantErr: `has no value at JSON path "data.missing"`},
+		{name: "index out of range", path: "data.items.2.name", wantErr: `has no value at JSON path "data.items.2"`},
+		{name: "negative index", path: "data.items.-1", wantErr: `has no value at JSON path "data.items.-1"`},
+		{name: "index into an object", path: "data.0", wantErr: `has no value at JSON path "data.0"`},
+		{name: "walk past a leaf", path: "status.code", wantErr: `has no value at JSON path "status.code"`},
+		{name: "not JSON", path: "status", body: "OK", wantErr: "is not valid JSON"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.ExpectedJSONPath = test.path
+			cfg.ExpectedJSONValue = test.value
+			data := body
+			if len(test.body) != 0 {
+				data = test.body
+			}
+			checkBodyError(t, validateBody(cfg, []byte(data)), test.wantErr)
+		})
+	}
+}
@@ -0,0 +1,522 @@
+package httpcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaErrors caps how many schema violations are reported for one body.
+const maxSchemaErrors = 5
+
+// ignoredSchemaKeywords lists annotation keywords that do not affect
+// validation.
+var ignoredSchemaKeywords = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+	"format":      true,
+	"deprecated":  true,
+	"readOnly":    true,
+	"writeOnly":   true,
+}
+
+// JSONSchema is a compiled JSON Schema. It supports the validation keywords
+// type, enum, const, properties, required, additionalProperties, items,
+// minItems, maxItems, uniqueItems, minLength, maxLength, pattern, minimum,
+// maximum, exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf,
+// oneOf, and not. References are not supported.
+type JSONSchema struct {
+	// reject is set for the false schema, which matches nothing.
+	reject bool
+	// types lists the accepted JSON types.
+	types []string
+	// enum lists the accepted values.
+	enum []any
+	// constValue is the only accepted value when hasConst is set.
+	constValue any
+	// hasConst records whether const was given, since it may be null.
+	hasConst bool
+	// properties holds the schemas of named object members.
+	properties map[string]*JSONSchema
+	// required lists the object members that must be present.
+	required []string
+	// additionalProperties applies to object members not in properties.
+	additionalProperties *JSONSchema
+	// items applies to every array element.
+	items *JSONSchema
+	// minItems and maxItems bound the array length when set.
+	minItems, maxItems *int
+	// uniqueItems requires distinct array elements.
+	uniqueItems bool
+	// minLength and maxLength bound the string length when set.
+	minLength, maxLength *int
+	// pattern is a regular expression strings must match.
+	pattern *regexp.Regexp
+	// minimum, maximum, exclusiveMinimum, and exclusiveMaximum bound numbers
+	// when set.
+	minimum, maximum, exclusiveMinimum, exclusiveMaximum *float64
+	// multipleOf requires numbers to divide evenly by it when set.
+	multipleOf *float64
+	// allOf, anyOf, and oneOf combine subschemas.
+	allOf, anyOf, oneOf []*JSONSchema
+	// not is a schema the value must not match.
+	not *JSONSchema
+}
+
+// ParseJSONSchema compiles a JSON Schema document.
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	// Decode the document before compiling it.
+	var document any
+	err := json.Unmarshal(data, &document)
+	if err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+
+	return compileSchema(document, "#")
+}
+
+// compileSchema compiles one schema node found at location.
+func compileSchema(node any, location string) (*JSONSchema, error) {
+	// Boolean schemas accept everything or nothing.
+	if accept, ok := node.(bool); ok {
+		return &JSONSchema{reject: !accept}, nil
+	}
+	keywords, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema at %s must be an object or a boolean", location)
+	}
+
+	// Compile each keyword in a stable order so errors are reproducible.
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	schema := &JSONSchema{}
+	for _, name := range names {
+		err := schema.compileKeyword(name, keywords[name], location+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return schema, nil
+}
+
+// compileKeyword applies one keyword to the schema being compiled.
+func (s *JSONSchema) compileKeyword(name string, value any, location string) error {
+	// Skip annotations.
+	if ignoredSchemaKeywords[name] {
+		return nil
+	}
+
+	var err error
+	switch name {
+	case "type":
+		s.types, err = schemaTypes(value, location)
+	case "enum":
+		list, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("schema keyword %s must be an array", location)
+		}
+		s.enum = list
+	case "const":
+		s.constValue = value
+		s.hasConst = true
+	case "properties":
+		members, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("schema keyword %s must be an object", location)
+		}
+		s.properties = make(map[string]*JSONSchema, len(members))
+		for member, memberSchema := range members {
+			s.properties[member], err = compileSchema(memberSchema, location+"/"+member)
+			if err != nil {
+				return err
+			}
+		}
+	case "required":
+		s.required, err = schemaStrings(value, location)
+	case "additionalProperties":
+		s.additionalProperties, err = compileSchema(value, location)
+	case "items":
+		s.items, err = compileSchema(value, location)
+	case "minItems":
+		s.minItems, err = schemaCount(value, location)
+	case "maxItems":
+		s.maxItems, err = schemaCount(value, location)
+	case "uniqueItems":
+		unique, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("schema keyword %s must be a boolean", location)
+		}
+		s.uniqueItems = unique
+	case "minLength":
+		s.minLength, err = schemaCount(value, location)
+	case "maxLength":
+		s.maxLength, err = schemaCount(value, location)
+	case "pattern":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("schema keyword %s must be a string", location)
+		}
+		s.pattern, err = regexp.Compile(text)
+		if err != nil {
+			return fmt.Errorf("schema keyword %s is not a valid pattern: %w", location, err)
+		}
+	case "minimum":
+		s.minimum, err = schemaNumber(value, location)
+	case "maximum":
+		s.maximum, err = schemaNumber(value, location)
+	case "exclusiveMinimum":
+		s.exclusiveMinimum, err = schemaNumber(value, location)
+	case "exclusiveMaximum":
+		s.exclusiveMaximum, err = schemaNumber(value, location)
+	case "multipleOf":
+		s.multipleOf, err = schemaNumber(value, location)
+		if err == nil && !(*s.multipleOf > 0) {
+			return fmt.Errorf("schema keyword %s must be greater than 0", location)
+		}
+	case "allOf":
+		s.allOf, err = schemaList(value, location)
+	case "anyOf":
+		s.anyOf, err = schemaList(value, location)
+	case "oneOf":
+		s.oneOf, err = schemaList(value, location)
+	case "not":
+		s.not, err = compileSchema(value, location)
+	default:
+		return fmt.Errorf("unsupported schema keyword %s", location)
+	}
+
+	return err
+}
+
+// schemaTypes parses the type keyword, which is a name or a list of names.
+func schemaTypes(value any, location string) ([]string, error) {
+	// Accept a single name as a one-item list.
+	if name, ok := value.(string); ok {
+		value = []any{name}
+	}
+	names, err := schemaStrings(value, location)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		switch name {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("schema keyword %s has unknown type %q", location, name)
+		}
+	}
+
+	return names, nil
+}
+
+// schemaStrings parses a keyword holding an array of strings.
+func schemaStrings(value any, location string) ([]string, error) {
+	// Check every element.
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("schema keyword %s must be an array of strings", location)
+	}
+	strs := make([]string, 0, len(list))
+	for _, item := range list {
+		text, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("schema keyword %s must be an array of strings", location)
+		}
+		strs = append(strs, text)
+	}
+
+	return strs, nil
+}
+
+// schemaCount parses a keyword holding a non-negative integer.
+func schemaCount(value any, location string) (*int, error) {
+	// JSON numbers decode as float64.
+	number, ok := value.(float64)
+	if !ok || number < 0 || number != math.Trunc(number) {
+		return nil, fmt.Errorf("schema keyword %s must be a non-negative integer", location)
+	}
+	count := int(number)
+
+	return &count, nil
+}
+
+// schemaNumber parses a keyword holding a number.
+func schemaNumber(value any, location string) (*float64, error) {
+	// JSON numbers decode as float64.
+	number, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("schema keyword %s must be a number", location)
+	}
+
+	return &number, nil
+}
+
+// schemaList parses a keyword holding a non-empty array of schemas.
+func schemaList(value any, location string) ([]*JSONSchema, error) {
+	// Compile every element.
+	list, ok := value.([]any)
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("schema keyword %s must be a non-empty array", location)
+	}
+	schemas := make([]*JSONSchema, 0, len(list))
+	for i, item := range list {
+		schema, err := compileSchema(item, location+"/"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, nil
+}
+
+// validateJSONSchema decodes body and validates it against schema, returning
+// an error that lists the first few violations.
+func validateJSONSchema(schema *JSONSchema, body []byte) error {
+	// Decode the body the same way as the schema so values compare equal.
+	var value any
+	err := json.Unmarshal(body, &value)
+	if err != nil {
+		return fmt.Errorf("is not valid JSON: %w", err)
+	}
+
+	// Report the violations, truncating long lists.
+	violations := schema.validate(value, "$")
+	if len(violations) == 0 {
+		return nil
+	}
+	more := ""
+	if len(violations) > maxSchemaErrors {
+		more = fmt.Sprintf(" (and %d more)", len(violations)-maxSchemaErrors)
+		violations = violations[:maxSchemaErrors]
+	}
+
+	return fmt.Errorf("does not match the JSON schema: %s%s", strings.Join(violations, "; "), more)
+}
+
+// validate returns every violation of s by value, which sits at path.
+func (s *JSONSchema) validate(value any, path string) []string {
+	// The false schema rejects everything.
+	if s.reject {
+		return []string{path + " is not allowed"}
+	}
+	violations := []string{}
+	if len(s.types) != 0 && !s.matchesType(value) {
+		return append(violations, fmt.Sprintf("%s is %s, expected %s", path, jsonTypeName(value), strings.Join(s.types, " or ")))
+	}
+	if len(s.enum) != 0 && !containsJSONValue(s.enum, value) {
+		violations = append(violations, fmt.Sprintf("%s is %s, expected one of the enum values", path, formatJSONValue(value)))
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constValue, value) {
+		violations = append(violations, fmt.Sprintf("%s is %s, expected %s", path, formatJSONValue(value), formatJSONValue(s.constValue)))
+	}
+
+	// Apply the keywords for the value's type.
+	switch typed := value.(type) {
+	case map[string]any:
+		violations = append(violations, s.validateObject(typed, path)...)
+	case []any:
+		violations = append(violations, s.validateArray(typed, path)...)
+	case string:
+		violations = append(violations, s.validateString(typed, path)...)
+	case float64:
+		violations = append(violations, s.validateNumber(typed, path)...)
+	}
+
+	// Apply the combinators.
+	for _, sub := range s.allOf {
+		violations = append(violations, sub.validate(value, path)...)
+	}
+	if len(s.anyOf) != 0 && s.countMatches(s.anyOf, value, path) == 0 {
+		violations = append(violations, path+" does not match any schema in anyOf")
+	}
+	if len(s.oneOf) != 0 {
+		matches := s.countMatches(s.oneOf, value, path)
+		if matches != 1 {
+			violations = append(violations, fmt.Sprintf("%s matches %d schemas in oneOf, expected exactly 1", path, matches))
+		}
+	}
+	if s.not != nil && len(s.not.validate(value, path)) == 0 {
+		violations = append(violations, path+" matches the schema in not")
+	}
+
+	return violations
+}
+
+// validateObject applies the object keywords.
+func (s *JSONSchema) validateObject(object map[string]any, path string) []string {
+	// Check the required members first.
+	violations := []string{}
+	for _, name := range s.required {
+		if _, ok := object[name]; !ok {
+			violations = append(violations, fmt.Sprintf("%s is missing required property %q", path, name))
+		}
+	}
+
+	// Validate each member in a stable order.
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		memberPath := path + "." + name
+		if sub, ok := s.properties[name]; ok {
+			violations = append(violations, sub.validate(object[name], memberPath)...)
+			continue
+		}
+		if s.additionalProperties != nil {
+			violations = append(violations, s.additionalProperties.validate(object[name], memberPath)...)
+		}
+	}
+
+	return violations
+}
+
+// validateArray applies the array keywords.
+func (s *JSONSchema) validateArray(array []any, path string) []string {
+	// Check the length.
+	violations := []string{}
+	if s.minItems != nil && len(array) < *s.minItems {
+		violations = append(violations, fmt.Sprintf("%s has %d items, expected at least %d", path, len(array), *s.minItems))
+	}
+	if s.maxItems != nil && len(array) > *s.maxItems {
+		violations = append(violations, fmt.Sprintf("%s has %d items, expected at most %d", path, len(array), *s.maxItems))
+	}
+
+	// Check the elements.
+	for i, item := range array {
+		if s.uniqueItems && containsJSONValue(array[:i], item) {
+			violations = append(violations, fmt.Sprintf("%s[%d] repeats an earlier item", path, i))
+		}
+		if s.items != nil {
+			violations = append(violations, s.items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	return violations
+}
+
+// validateString applies the string keywords.
+func (s *JSONSchema) validateString(text string, path string) []string {
+	// Lengths count characters, not bytes.
+	violations := []string{}
+	length := utf8.RuneCountInString(text)
+	if s.minLength != nil && length < *s.minLength {
+		violations = append(violations, fmt.Sprintf("%s has length %d, expected at least %d", path, length, *s.minLength))
+	}
+	if s.maxLength != nil && length > *s.maxLength {
+		violations = append(violations, fmt.Sprintf("%s has length %d, expected at most %d", path, length, *s.maxLength))
+	}
+	if s.pattern != nil && !s.pattern.MatchString(text) {
+		violations = append(violations, fmt.Sprintf("%s does not match pattern %q", path, s.pattern.String()))
+	}
+
+	return violations
+}
+
+// validateNumber applies the number keywords.
+func (s *JSONSchema) validateNumber(number float64, path string) []string {
+	// Check each bound that is set.
+	violations := []string{}
+	if s.minimum != nil && number < *s.minimum {
+		violations = append(violations, fmt.Sprintf("%s is %v, expected at least %v", path, number, *s.minimum))
+	}
+	if s.maximum != nil && number > *s.maximum {
+		violations = append(violations, fmt.Sprintf("%s is %v, expected at most %v", path, number, *s.maximum))
+	}
+	if s.exclusiveMinimum != nil && number <= *s.exclusiveMinimum {
+		violations = append(violations, fmt.Sprintf("%s is %v, expected more than %v", path, number, *s.exclusiveMinimum))
+	}
+	if s.exclusiveMaximum != nil && number >= *s.exclusiveMaximum {
+		violations = append(violations, fmt.Sprintf("%s is %v, expected less than %v", path, number, *s.exclusiveMaximum))
+	}
+	if s.multipleOf != nil {
+		quotient := number / *s.multipleOf
+		if quotient != math.Trunc(quotient) {
+			violations = append(violations, fmt.Sprintf("%s is %v, expected a multiple of %v", path, number, *s.multipleOf))
+		}
+	}
+
+	return violations
+}
+
+// countMatches returns how many of schemas value satisfies.
+func (s *JSONSchema) countMatches(schemas []*JSONSchema, value any, path string) int {
+	// Count the schemas without violations.
+	matches := 0
+	for _, sub := range schemas {
+		if len(sub.validate(value, path)) == 0 {
+			matches++
+		}
+	}
+
+	return matches
+}
+
+// matchesType reports whether value has one of the accepted types. Integers
+// are numbers without a fractional part.
+func (s *JSONSchema) matchesType(value any) bool {
+	// Compare against each accepted type.
+	actual := jsonTypeName(value)
+	for _, name := range s.types {
+		if name == actual {
+			return true
+		}
+		if name == "number" && actual == "integer" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonTypeName returns the JSON Schema type of a decoded value, reporting
+// whole numbers as integers.
+func jsonTypeName(value any) string {
+	// Map the decoded Go types.
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case float64:
+		if typed == math.Trunc(typed) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// containsJSONValue reports whether list holds a value equal to value.
+func containsJSONValue(list []any, value any) bool {
+	// Decoded JSON values compare structurally.
+	for _, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
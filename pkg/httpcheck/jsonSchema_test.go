@@ -0,0 +1,235 @@
+package httpcheck
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestParseJSONSchemaRejects checks schemas using keywords outside the
+// supported subset, or supported keywords with bad values, fail to compile
+// rather than being silently ignored.
+func TestParseJSONSchemaRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{name: "not JSON", schema: `{"type":`, wantErr: "schema is not valid JSON"},
+		{name: "not an object", schema: `"string"`, wantErr: "schema at # must be an object or a boolean"},
+		{name: "$ref", schema: `{"$ref":"#/$defs/name"}`, wantErr: "unsupported schema keyword #/$ref"},
+		{name: "$defs", schema: `{"$defs":{"name":{"type":"string"}}}`, wantErr: "unsupported schema keyword #/$defs"},
+		{name: "definitions", schema: `{"definitions":{}}`, wantErr: "unsupported schema keyword #/definitions"},
+		{name: "patternProperties", schema: `{"patternProperties":{"^x":{}}}`, wantErr: "unsupported schema keyword #/patternProperties"},
+		{name: "if", schema: `{"if":{"type":"string"},"then":{"minLength":1}}`, wantErr: "unsupported schema keyword #/if"},
+		{name: "then", schema: `{"then":{}}`, wantErr: "unsupported schema keyword #/then"},
+		{name: "else", schema: `{"else":{}}`, wantErr: "unsupported schema keyword #/else"},
+		{name: "contains", schema: `{"contains":{"const":1}}`, wantErr: "unsupported schema keyword #/contains"},
+		{name: "prefixItems", schema: `{"prefixItems":[{"type":"string"}]}`, wantErr: "unsupported schema keyword #/prefixItems"},
+		{name: "minProperties", schema: `{"minProperties":1}`, wantErr: "unsupported schema keyword #/minProperties"},
+		{name: "maxProperties", schema: `{"maxProperties":1}`, wantErr: "unsupported schema keyword #/maxProperties"},
+		{name: "propertyNames", schema: `{"propertyNames":{"pattern":"^a"}}`, wantErr: "unsupported schema keyword #/propertyNames"},
+		{name: "dependentRequired", schema: `{"dependentRequired":{"a":["b"]}}`, wantErr: "unsupported schema keyword #/dependentRequired"},
+		{name: "nested unsupported keyword", schema: `{"properties":{"a":{"items":{"$ref":"#"}}}}`, wantErr: "unsupported schema keyword #/properties/a/items/$ref"},
+		{name: "unsupported keyword in a list", schema: `{"anyOf":[{"type":"string"},{"contains":{}}]}`, wantErr: "unsupported schema keyword #/anyOf/1/contains"},
+		{name: "unknown type", schema: `{"type":"float"}`, wantErr: `schema keyword #/type has unknown type "float"`},
+		{name: "type not a string", schema: `{"type":1}`, wantErr: "schema keyword #/type must be an array of strings"},
+		{name: "enum not an array", schema: `{"enum":"a"}`, wantErr: "schema keyword #/enum must be an array"},
+		{name: "properties not an object", schema: `{"properties":[]}`, wantErr: "schema keyword #/properties must be an object"},
+		{name: "required not strings", schema: `{"required":["a",1]}`, wantErr: "schema keyword #/required must be an array of strings"},
+		{name: "negative minItems", schema: `{"minItems":-1}`, wantErr: "schema keyword #/minItems must be a non-negative integer"},
+		{name: "fractional maxLength", schema: `{"maxLength":1.5}`, wantErr: "schema keyword #/maxLength must be a non-negative integer"},
+		{name: "uniqueItems not a boolean", schema: `{"uniqueItems":"yes"}`, wantErr: "schema keyword #/uniqueItems must be a boolean"},
+		{name: "pattern not a string", schema: `{"pattern":1}`, wantErr: "schema keyword #/pattern must be a string"},
+		{name: "bad pattern", schema: `{"pattern":"("}`, wantErr: "schema keyword #/pattern is not a valid pattern"},
+		{name: "minimum not a number", schema: `{"minimum":"1"}`, wantErr: "schema keyword #/minimum must be a number"},
+		{name: "boolean exclusiveMinimum", schema: `{"exclusiveMinimum":true}`, wantErr: "schema keyword #/exclusiveMinimum must be a number"},
+		{name: "zero multipleOf", schema: `{"multipleOf":0}`, wantErr: "schema keyword #/multipleOf must be greater than 0"},
+		{name: "empty allOf", schema: `{"allOf":[]}`, wantErr: "schema keyword #/allOf must be a non-empty array"},
+		{name: "oneOf not an array", schema: `{"oneOf":{}}`, wantErr: "schema keyword #/oneOf must be a non-empty array"},
+		{name: "not is a string", schema: `{"not":"x"}`, wantErr: "schema at #/not must be an object or a boolean"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema, err := ParseJSONSchema([]byte(test.schema))
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("ParseJSONSchema = %v, %v, want an error containing %q", schema, err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestParseJSONSchemaAnnotations checks annotation keywords compile and do
+// not affect validation.
+func TestParseJSONSchemaAnnotations(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "https://example.com/health.json",
+		"$comment": "health endpoint",
+		"title": "Health",
+		"description": "The health response.",
+		"default": {},
+		"examples": [{"status": "ok"}],
+		"deprecated": false,
+		"readOnly": true,
+		"writeOnly": false,
+		"properties": {"checked": {"type": "string", "format": "date-time"}}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseJSONSchema returned an error: %v", err)
+	}
+
+	// Formats are annotations, so any string passes.
+	checkBodyError(t, validateJSONSchema(schema, []byte(`{"checked":"not a date"}`)), "")
+}
+
+// TestValidateJSONSchema checks each supported keyword accepts matching
+// values and reports the path of values that do not match.
+func TestValidateJSONSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		body    string
+		wantErr string
+	}{
+		// Boolean schemas.
+		{name: "true schema", schema: `true`, body: `{"a":1}`},
+		{name: "false schema", schema: `false`, body: `{}`, wantErr: "$ is not allowed"},
+		{name: "empty schema", schema: `{}`, body: `[null,1,"a"]`},
+
+		// type
+		{name: "type matches", schema: `{"type":"object"}`, body: `{}`},
+		{name: "type mismatch", schema: `{"type":"object"}`, body: `[]`, wantErr: "$ is array, expected object"},
+		{name: "type list", schema: `{"type":["string","null"]}`, body: `null`},
+		{name: "type list mismatch", schema: `{"type":["string","null"]}`, body: `true`, wantErr: "$ is boolean, expected string or null"},
+		{name: "integer accepts whole numbers", schema: `{"type":"integer"}`, body: `2.0`},
+		{name: "integer rejects fractions", schema: `{"type":"integer"}`, body: `2.5`, wantErr: "$ is number, expected integer"},
+		{name: "number accepts integers", schema: `{"type":"number"}`, body: `2`},
+
+		// enum and const
+		{name: "enum matches", schema: `{"enum":["ok","degraded"]}`, body: `"ok"`},
+		{name: "enum mismatch", schema: `{"enum":["ok","degraded"]}`, body: `"down"`, wantErr: "$ is down, expected one of the enum values"},
+		{name: "enum compares structurally", schema: `{"enum":[{"a":[1,2]}]}`, body: `{"a":[1,2]}`},
+		{name: "const matches", schema: `{"const":{"status":"ok"}}`, body: `{"status":"ok"}`},
+		{name: "const null", schema: `{"const":null}`, body: `0`, wantErr: "$ is 0, expected null"},
+		{name: "const mismatch", schema: `{"const":"ok"}`, body: `"OK"`, wantErr: "$ is OK, expected ok"},
+
+		// Objects.
+		{name: "required present", schema: `{"required":["status"]}`, body: `{"status":"ok"}`},
+		{name: "required missing", schema: `{"required":["status","version"]}`, body: `{"status":"ok"}`, wantErr: `$ is missing required property "version"`},
+		{name: "required ignores non-objects", schema: `{"required":["status"]}`, body: `"ok"`},
+		{name: "properties", schema: `{"properties":{"status":{"const":"ok"}}}`, body: `{"status":"ok","other":1}`},
+		{name: "property mismatch", schema: `{"properties":{"status":{"const":"ok"}}}`, body: `{"status":"down"}`, wantErr: "$.status is down, expected ok"},
+		{name: "nested property path", schema: `{"properties":{"db":{"properties":{"up":{"type":"boolean"}}}}}`, body: `{"db":{"up":"yes"}}`, wantErr: "$.db.up is string, expected boolean"},
+		{name: "additionalProperties false", schema: `{"properties":{"a":{}},"additionalProperties":false}`, body: `{"a":1,"b":2}`, wantErr: "$.b is not allowed"},
+		{name: "additionalProperties schema", schema: `{"additionalProperties":{"type":"integer"}}`, body: `{"a":1,"b":"2"}`, wantErr: "$.b is string, expected integer"},
+		{name: "additionalProperties skips named members", schema: `{"properties":{"a":{"type":"string"}},"additionalProperties":{"type":"integer"}}`, body: `{"a":"x","b":2}`},
+
+		// Arrays.
+		{name: "items", schema: `{"items":{"type":"string"}}`, body: `["a","b"]`},
+		{name: "items mismatch", schema: `{"items":{"type":"string"}}`, body: `["a",2]`, wantErr: "$[1] is integer, expected string"},
+		{name: "minItems", schema: `{"minItems":2}`, body: `[1]`, wantErr: "$ has 1 items, expected at least 2"},
+		{name: "maxItems", schema: `{"maxItems":1}`, body: `[1,2]`, wantErr: "$ has 2 items, expected at most 1"},
+		{name: "items within bounds", schema: `{"minItems":1,"maxItems":2}`, body: `[1,2]`},
+		{name: "uniqueItems", schema: `{"uniqueItems":true}`, body: `[1,{"a":1},[2]]`},
+		{name: "uniqueItems repeated", schema: `{"uniqueItems":true}`, body: `[{"a":1},2,{"a":1}]`, wantErr: "$[2] repeats an earlier item"},
+		{name: "uniqueItems false allows repeats", schema: `{"uniqueItems":false}`, body: `[1,1]`},
+
+		// Strings.
+		{name: "minLength counts characters", schema: `{"minLength":2}`, body: `"éé"`},
+		{name: "minLength", schema: `{"minLength":2}`, body: `"a"`, wantErr: "$ has length 1, expected at least 2"},
+		{name: "maxLength", schema: `{"maxLength":2}`, body: `"abc"`, wantErr: "$ has length 3, expected at most 2"},
+		{name: "pattern", schema: `{"pattern":"^v[0-9]+"}`, body: `"v12-beta"`},
+		{name: "pattern mismatch", schema: `{"pattern":"^v[0-9]+$"}`, body: `"12"`, wantErr: `$ does not match pattern "^v[0-9]+$"`},
+		{name: "string keywords ignore numbers", schema: `{"minLength":5,"pattern":"^a"}`, body: `1`},
+
+		// Numbers.
+		{name: "minimum inclusive", schema: `{"minimum":1}`, body: `1`},
+		{name: "minimum", schema: `{"minimum":1}`, body: `0.5`, wantErr: "$ is 0.5, expected at least 1"},
+		{name: "maximum inclusive", schema: `{"maximum":1}`, body: `1`},
+		{name: "maximum", schema: `{"maximum":1}`, body: `2`, wantErr: "$ is 2, expected at most 1"},
+		{name: "exclusiveMinimum", schema: `{"exclusiveMinimum":1}`, body: `1`, wantErr: "$ is 1, expected more than 1"},
+		{name: "exclusiveMaximum", schema: `{"exclusiveMaximum":1}`, body: `1`, wantErr: "$ is 1, expected less than 1"},
+		{name: "exclusive bounds", schema: `{"exclusiveMinimum":0,"exclusiveMaximum":1}`, body: `0.5`},
+		{name: "multipleOf", schema: `{"multipleOf":0.5}`, body: `2.5`},
+		{name: "multipleOf mismatch", schema: `{"multipleOf":2}`, body: `3`, wantErr: "$ is 3, expected a multiple of 2"},
+
+		// Combinators.
+		{name: "allOf", schema: `{"allOf":[{"type":"integer"},{"minimum":1}]}`, body: `2`},
+		{name: "allOf mismatch", schema: `{"allOf":[{"type":"integer"},{"minimum":1}]}`, body: `0`, wantErr: "$ is 0, expected at least 1"},
+		{name: "anyOf", schema: `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, body: `1`},
+		{name: "anyOf mismatch", schema: `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, body: `true`, wantErr: "$ does not match any schema in anyOf"},
+		{name: "oneOf", schema: `{"oneOf":[{"type":"string"},{"type":"integer"}]}`, body: `"a"`},
+		{name: "oneOf matches none", schema: `{"oneOf":[{"type":"string"},{"type":"integer"}]}`, body: `null`, wantErr: "$ matches 0 schemas in oneOf, expected exactly 1"},
+		{name: "oneOf matches both", schema: `{"oneOf":[{"type":"number"},{"type":"integer"}]}`, body: `1`, wantErr: "$ matches 2 schemas in oneOf, expected exactly 1"},
+		{name: "not", schema: `{"not":{"const":"down"}}`, body: `"up"`},
+		{name: "not mismatch", schema: `{"not":{"const":"down"}}`, body: `"down"`, wantErr: "$ matches the schema in not"},
+
+		// Document-level failures.
+		{name: "invalid JSON body", schema: `{}`, body: `{"status":`, wantErr: "is not valid JSON"},
+		{name: "empty body", schema: `{}`, body: ``, wantErr: "is not valid JSON"},
+		{name: "violations joined", schema: `{"required":["a","b"]}`, body: `{}`, wantErr: `does not match the JSON schema: $ is missing required property "a"; $ is missing required property "b"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema, err := ParseJSONSchema([]byte(test.schema))
+			if err != nil {
+				t.Fatalf("ParseJSONSchema returned an error: %v", err)
+			}
+			checkBodyError(t, validateJSONSchema(schema, []byte(test.body)), test.wantErr)
+		})
+	}
+}
+
+// TestValidateJSONSchemaTruncates checks only the first violations are
+// listed and the rest are counted.
+func TestValidateJSONSchemaTruncates(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(`{"items":{"type":"string"}}`))
+	if err != nil {
+		t.Fatalf("ParseJSONSchema returned an error: %v", err)
+	}
+	err = validateJSONSchema(schema, []byte(`[1,2,3,4,5,6,7]`))
+	checkBodyError(t, err, "$[4] is integer, expected string (and 2 more)")
+	if err != nil && strings.Contains(err.Error(), "$[5]") {
+		t.Errorf("error %q lists more than %d violations", err, maxSchemaErrors)
+	}
+}
+
+// TestRunExpectedJSONSchema checks the schema is applied to real responses.
+func TestRunExpectedJSONSchema(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(`{
+		"type": "object",
+		"required": ["status"],
+		"properties": {"status": {"enum": ["ok", "degraded"]}}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseJSONSchema returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantPass bool
+	}{
+		{name: "match", body: `{"status":"ok","uptime":12}`, wantPass: true},
+		{name: "mismatch", body: `{"status":"down"}`, wantPass: false},
+		{name: "not JSON", body: `OK`, wantPass: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = io.WriteString(w, test.body)
+			}))
+			defer server.Close()
+
+			cfg := newTestConfig(t, server.URL)
+			cfg.ExpectedJSONSchema = schema
+			summary := runTestConfig(t, cfg)
+			if summary.Passed(cfg, cfg.Count) != test.wantPass {
+				t.Errorf("passed = %v, want %v, failures: %v", !test.wantPass, test.wantPass, summary.FailureMessages())
+			}
+		})
+	}
+}
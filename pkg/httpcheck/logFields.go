@@ -0,0 +1,91 @@
+package httpcheck
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redactedValue replaces header values that must not be logged.
+const redactedValue = "[redacted]"
+
+// sensitiveResponseHeaders lists response headers whose values are never
+// logged.
+var sensitiveResponseHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Set-Cookie",
+}
+
+// requestFields returns the structured fields describing a request to
+// parsedURL.
+func requestFields(cfg *Config, parsedURL *url.URL) log.Fields {
+	return log.Fields{
+		"url":    cfg.RedactURL(parsedURL),
+		"method": cfg.RequestType,
+	}
+}
+
+// resultFields returns the structured fields describing a completed check.
+func resultFields(cfg *Config, parsedURL *url.URL, result Result) log.Fields {
+	// Start from the request fields and add the outcome.
+	fields := requestFields(cfg, parsedURL)
+	fields["duration_ms"] = result.Duration.Milliseconds()
+	fields["attempt"] = result.Attempts
+	if result.StatusCode != 0 {
+		fields["status_code"] = result.StatusCode
+	}
+	if len(result.ErrorCategory) != 0 {
+		fields["error_category"] = string(result.ErrorCategory)
+	}
+	if len(result.RotatedValue) != 0 {
+		fields["rotated_value"] = result.RotatedValue
+	}
+
+	return fields
+}
+
+// redactResponseHeaders flattens response headers into one value per name,
+// redacting the values of sensitive headers.
+func redactResponseHeaders(header http.Header) map[string]string {
+	// Join repeated values and mask sensitive ones.
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		for _, sensitive := range sensitiveResponseHeaders {
+			if http.CanonicalHeaderKey(name) == sensitive {
+				value = redactedValue
+			}
+		}
+		headers[name] = value
+	}
+
+	return headers
+}
+
+// logResponseMetadata logs the request and response headers of response at
+// debug level. Request header values may carry credentials, so only their
+// names are logged, and sensitive response header values are redacted.
+func logResponseMetadata(fields log.Fields, response *http.Response) {
+	// Skip building the header maps unless debug output is enabled.
+	if !log.IsLevelEnabled(log.DebugLevel) {
+		return
+	}
+
+	// Redact every request header value.
+	requestHeaders := make(map[string]string)
+	if response.Request != nil {
+		for name := range response.Request.Header {
+			requestHeaders[name] = redactedValue
+		}
+	}
+
+	log.WithFields(fields).WithFields(log.Fields{
+		"protocol":         response.Proto,
+		"request_headers":  requestHeaders,
+		"response_headers": redactResponseHeaders(response.Header),
+		"content_length":   response.ContentLength,
+	}).Debugln("Response metadata")
+}
@@ -0,0 +1,94 @@
+package httpcheck
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// pacer spaces out the request starts of a single worker. The interval
+// starts at cfg.Seconds and is multiplied by cfg.SecondsBackoffFactor after
+// every request, up to cfg.SecondsMax. Each wait is randomized by up to
+// cfg.JitterPercent of the interval in either direction.
+type pacer struct {
+	// interval is the time between the current and next request start.
+	interval time.Duration
+	// factor multiplies the interval after each request.
+	factor float64
+	// max caps the interval. Zero leaves it uncapped.
+	max time.Duration
+	// jitter is the largest random change to a wait, as a fraction of the
+	// interval.
+	jitter float64
+	// random draws the jitter.
+	random *rand.Rand
+	// last is when the current request started.
+	last time.Time
+	// onWait is told about each wait before it starts when set.
+	onWait func(delay time.Duration)
+}
+
+// newPacer builds the pacer for the given worker. With cfg.RandomSeed set,
+// every worker draws its own reproducible jitter sequence.
+func newPacer(cfg *Config, worker int) *pacer {
+	// Seed the jitter from the clock unless a seed is configured.
+	seed := uint64(cfg.RandomSeed)
+	if cfg.RandomSeed == 0 {
+		seed = rand.Uint64()
+	}
+
+	// Convert the configured seconds to durations.
+	return &pacer{
+		interval: time.Duration(cfg.Seconds) * time.Second,
+		factor:   cfg.SecondsBackoffFactor,
+		max:      time.Duration(cfg.SecondsMax) * time.Second,
+		jitter:   float64(cfg.JitterPercent) / 100,
+		random:   rand.New(rand.NewPCG(seed, uint64(worker))),
+		onWait:   cfg.OnWait,
+	}
+}
+
+// started records the start of a request.
+func (p *pacer) started() {
+	p.last = time.Now()
+}
+
+// wait blocks until the next request may start, or until ctx is done, and
+// then grows the interval.
+func (p *pacer) wait(ctx context.Context) {
+	// Skip when no pause is configured.
+	if p.interval <= 0 {
+		return
+	}
+
+	// Measure from the request start so slow requests do not stretch the pace.
+	delay := time.Until(p.last.Add(p.jittered()))
+	notifyWait(p.onWait, delay)
+	sleepContext(ctx, delay)
+
+	// Grow the interval, keeping it within the cap and time.Duration's range.
+	if p.factor <= 1 {
+		return
+	}
+	next := float64(p.interval) * p.factor
+	if next >= math.MaxInt64 {
+		next = math.MaxInt64
+	}
+	p.interval = time.Duration(next)
+	if p.max > 0 && p.interval > p.max {
+		p.interval = p.max
+	}
+}
+
+// jittered returns the current interval shifted by a random amount of up to
+// the jitter fraction in either direction.
+func (p *pacer) jittered() time.Duration {
+	// Keep the interval as is when jitter is off.
+	if p.jitter == 0 {
+		return p.interval
+	}
+	scale := 1 + (p.random.Float64()*2-1)*p.jitter
+
+	return time.Duration(float64(p.interval) * scale)
+}
@@ -0,0 +1,86 @@
+package httpcheck
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// redactedQueryValue replaces sensitive query parameter values. It matches the
+// placeholder url.URL.Redacted uses for passwords.
+const redactedQueryValue = "xxxxx"
+
+// DefaultRedactQueryParams lists the query parameters masked when a URL is
+// logged or reported, unless the config overrides them.
+var DefaultRedactQueryParams = []string{
+	"access_token",
+	"api_key",
+	"apikey",
+	"auth",
+	"key",
+	"password",
+	"secret",
+	"sig",
+	"signature",
+	"token",
+}
+
+// RedactURL renders u with its password and the values of the query
+// parameters named in params masked. Parameter names match case-insensitively
+// and the original parameter order is kept.
+func RedactURL(u *url.URL, params []string) string {
+	// Mask the password first.
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	if redacted.User != nil {
+		if _, hasPassword := redacted.User.Password(); hasPassword {
+			redacted.User = url.UserPassword(redacted.User.Username(), redactedQueryValue)
+		}
+	}
+	if len(redacted.RawQuery) == 0 || len(params) == 0 {
+		return redacted.String()
+	}
+
+	// Mask each sensitive parameter in place.
+	pairs := strings.Split(redacted.RawQuery, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if slices.ContainsFunc(params, func(param string) bool { return strings.EqualFold(param, name) }) {
+			pairs[i] = key + "=" + redactedQueryValue
+		}
+	}
+	redacted.RawQuery = strings.Join(pairs, "&")
+
+	return redacted.String()
+}
+
+// RedactURL renders u with credentials and the configured sensitive query
+// parameters masked.
+func (cfg *Config) RedactURL(u *url.URL) string {
+	return RedactURL(u, cfg.RedactQueryParams)
+}
+
+// redactError rewrites the URL inside a url.Error wrapped by err so the error
+// text only carries the redacted form.
+func redactError(err error, params []string) error {
+	// Only url.Error carries a raw URL.
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	parsedURL, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		urlErr.URL = "(unparseable URL)"
+		return err
+	}
+	urlErr.URL = RedactURL(parsedURL, params)
+
+	return err
+}
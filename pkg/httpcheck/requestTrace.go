@@ -0,0 +1,98 @@
+package httpcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ConnectionTiming holds the connection phase durations of a single request.
+// Phases that did not happen, such as DNS on a reused connection, stay zero.
+type ConnectionTiming struct {
+	// DNS is how long the DNS lookup took.
+	DNS time.Duration
+	// Connect is how long the TCP connection took.
+	Connect time.Duration
+	// TLSHandshake is how long the TLS handshake took.
+	TLSHandshake time.Duration
+	// TTFB is the time from the start of the request to the first byte of the
+	// final response, including any redirects.
+	TTFB time.Duration
+}
+
+// TimingRecorder collects ConnectionTiming from httptrace hooks.
+type TimingRecorder struct {
+	// mu guards the recorder while trace hooks run, which may be concurrent.
+	mu sync.Mutex
+	// timing holds the phase durations recorded so far.
+	timing ConnectionTiming
+	// dnsStart marks the start of the DNS lookup.
+	dnsStart time.Time
+	// connectStart marks the start of the first TCP connection attempt.
+	connectStart time.Time
+	// tlsStart marks the start of the TLS handshake.
+	tlsStart time.Time
+	// requestStart marks the start of the request.
+	requestStart time.Time
+}
+
+// Timing returns the phase durations recorded so far.
+func (r *TimingRecorder) Timing() ConnectionTiming {
+	// Copy under the lock so late hooks cannot race the reader.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.timing
+}
+
+// withTiming returns a context that records connection phases into recorder.
+func withTiming(ctx context.Context, recorder *TimingRecorder) context.Context {
+	// Record the start and end of each phase.
+	recorder.mu.Lock()
+	recorder.requestStart = time.Now()
+	recorder.mu.Unlock()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(_ httptrace.DNSStartInfo) {
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			recorder.dnsStart = time.Now()
+		},
+		DNSDone: func(_ httptrace.DNSDoneInfo) {
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			recorder.timing.DNS = time.Since(recorder.dnsStart)
+		},
+		ConnectStart: func(_, _ string) {
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			if recorder.connectStart.IsZero() {
+				recorder.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			if err == nil && recorder.timing.Connect == 0 {
+				recorder.timing.Connect = time.Since(recorder.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			recorder.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, _ error) {
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			recorder.timing.TLSHandshake = time.Since(recorder.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			recorder.timing.TTFB = time.Since(recorder.requestStart)
+		},
+	}
+
+	return httptrace.WithClientTrace(ctx, trace)
+}
@@ -0,0 +1,308 @@
+package httpcheck
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// maxDrainBytes caps how much of an unread body is discarded before it is
+	// closed. Larger bodies close the connection instead.
+	maxDrainBytes = 1 << 20
+	// maxSnippetBytes caps how much of a body is included in failure messages.
+	maxSnippetBytes = 256
+)
+
+// errBodyTooLarge is returned when a response body exceeds the configured
+// limit and FailOnLargeBody is set.
+var errBodyTooLarge = errors.New("response too large")
+
+// readBody reads up to limit bytes of the decoded response body. A longer body
+// is truncated, and also reported as errBodyTooLarge when strict is set.
+// Bodies the transport did not already decompress are decoded according to
+// their Content-Encoding. body is read in place of response.Body so callers
+// can observe the encoded stream.
+func readBody(response *http.Response, body io.Reader, limit int, strict bool) ([]byte, error) {
+	// Decode the body when it is still compressed.
+	reader, err := decodeBody(response, body)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// Limit the read so large responses cannot exhaust memory. One extra byte
+	// shows whether the body went past the limit.
+	data, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err != nil || len(data) <= limit {
+		return data, err
+	}
+	data = data[:limit]
+	if strict {
+		return data, fmt.Errorf("%w: more than %d bytes", errBodyTooLarge, limit)
+	}
+
+	return data, nil
+}
+
+// decodeBody wraps body in a decompressor for the gzip and deflate encodings
+// of response. Other bodies are returned unchanged.
+func decodeBody(response *http.Response, body io.Reader) (io.ReadCloser, error) {
+	// The transport already decoded bodies it asked to be compressed.
+	if response.Uncompressed {
+		return io.NopCloser(body), nil
+	}
+
+	switch strings.ToLower(response.Header.Get("Content-Encoding")) {
+	case "gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		return reader, nil
+	case "deflate":
+		reader, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deflate body: %w", err)
+		}
+		return reader, nil
+	default:
+		return io.NopCloser(body), nil
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	// reader is the underlying stream.
+	reader io.Reader
+	// n is how many bytes have been read.
+	n int64
+}
+
+// Read reads from the underlying stream and counts the bytes.
+func (r *countingReader) Read(p []byte) (int, error) {
+	// Count whatever was read, even alongside an error.
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countingReadCloser counts the bytes read from a response body while keeping
+// its Close.
+type countingReadCloser struct {
+	*countingReader
+	io.Closer
+}
+
+// countBody wraps the body of response so the bytes read from it, including
+// those drained on close, are counted. A switched connection is left as is
+// so it can still be written to, and counts nothing.
+func countBody(response *http.Response) *countingReader {
+	// Keep the upgraded connection writable.
+	if response.StatusCode == http.StatusSwitchingProtocols {
+		return &countingReader{}
+	}
+	counter := &countingReader{reader: response.Body}
+	response.Body = countingReadCloser{countingReader: counter, Closer: response.Body}
+
+	return counter
+}
+
+// cachedBody reads a response body at most once so validation and failure
+// reporting can share it.
+type cachedBody struct {
+	// response holds the body to read.
+	response *http.Response
+	// limit caps how many bytes are read.
+	limit int
+	// strict reports a body longer than limit as an error.
+	strict bool
+	// data is the body read so far.
+	data []byte
+	// err is the error returned by the read.
+	err error
+	// done records whether the body was read.
+	done bool
+	// wireBytes is how many bytes were read off the connection, before
+	// decoding.
+	wireBytes int64
+}
+
+// newCachedBody wraps response with the body limits from cfg.
+func newCachedBody(cfg *Config, response *http.Response) *cachedBody {
+	// Fall back to the default limit for configs built without NewConfig.
+	limit := cfg.MaxBodyBytes
+	if limit <= 0 {
+		limit = DefaultMaxBodyBytes
+	}
+
+	return &cachedBody{response: response, limit: limit, strict: cfg.FailOnLargeBody}
+}
+
+// read returns the response body, reading it on the first call.
+func (b *cachedBody) read() ([]byte, error) {
+	// Read only once. A switched connection has no body to read.
+	if b.response.StatusCode == http.StatusSwitchingProtocols {
+		b.done = true
+	}
+	if !b.done {
+		counter := &countingReader{reader: b.response.Body}
+		b.data, b.err = readBody(b.response, counter, b.limit, b.strict)
+		b.wireBytes = counter.n
+		b.done = true
+	}
+
+	return b.data, b.err
+}
+
+// readStream reads the body line by line until a line equal to want arrives,
+// reporting whether it did. Reading stops at the body limit, and the request
+// timeout bounds the wait. The body is then closed without draining since a
+// stream may never end, and what was read is kept for failure reports.
+func (b *cachedBody) readStream(want string) (bool, error) {
+	// Decode the stream as it arrives.
+	b.done = true
+	counter := &countingReader{reader: b.response.Body}
+	defer func() {
+		b.wireBytes = counter.n
+		_ = b.response.Body.Close()
+	}()
+	reader, err := decodeBody(b.response, counter)
+	if err != nil {
+		b.err = err
+		return false, err
+	}
+	defer reader.Close()
+
+	// Compare each complete or final line.
+	want = strings.TrimSpace(want)
+	lines := bufio.NewReader(io.LimitReader(reader, int64(b.limit)))
+	for {
+		line, err := lines.ReadString('\n')
+		b.data = append(b.data, line...)
+		if len(line) != 0 && strings.TrimSpace(line) == want {
+			return true, nil
+		}
+		if err == io.EOF && len(b.data) >= b.limit {
+			return false, errBodyTooLarge
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// closeBody drains and closes the response body so the connection can be reused.
+func closeBody(response *http.Response) {
+	// A switched connection never ends on its own, so close it undrained.
+	if response.StatusCode == http.StatusSwitchingProtocols {
+		_ = response.Body.Close()
+		return
+	}
+
+	// Discard any unread bytes before closing.
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxDrainBytes))
+	_ = response.Body.Close()
+}
+
+// bodySnippet returns a truncated, printable copy of body for log output.
+func bodySnippet(body []byte) string {
+	// Truncate long bodies.
+	if len(body) <= maxSnippetBytes {
+		return string(body)
+	}
+
+	return string(body[:maxSnippetBytes]) + "...(truncated)"
+}
+
+// extractSuccessValue returns the value at SuccessJSONPath in the response
+// body, truncated like a body snippet.
+func extractSuccessValue(cfg *Config, body *cachedBody) (string, error) {
+	// Read the body and look up the path.
+	data, err := body.read()
+	if err != nil {
+		return "", fmt.Errorf("error reading response body: %w", err)
+	}
+	value, err := lookupJSONPath(data, cfg.SuccessJSONPath)
+	if err != nil {
+		return "", err
+	}
+
+	return bodySnippet([]byte(formatJSONValue(value))), nil
+}
+
+// validateCompressionRatio requires the decoded body to be at least
+// MinCompressionRatio times larger than the encoded bytes read for it.
+func validateCompressionRatio(cfg *Config, response *http.Response, body *cachedBody) error {
+	// The wire size is lost once the transport decompresses the body.
+	if response.Uncompressed {
+		return fmt.Errorf("was decompressed by the transport, so its compression ratio is unknown. Set Accept-Encoding explicitly")
+	}
+	contentEncoding := response.Header.Get("Content-Encoding")
+	if len(contentEncoding) == 0 || strings.EqualFold(contentEncoding, "identity") {
+		return fmt.Errorf("was not compressed, expected a compression ratio of at least %v", cfg.MinCompressionRatio)
+	}
+
+	// Read the body and compare its decoded size with the wire size.
+	data, err := body.read()
+	if err != nil {
+		return fmt.Errorf("could not be read: %w", err)
+	}
+	if body.wireBytes == 0 {
+		return fmt.Errorf("was empty, so its compression ratio cannot be checked")
+	}
+	ratio := float64(len(data)) / float64(body.wireBytes)
+	if !(ratio >= cfg.MinCompressionRatio) {
+		return fmt.Errorf("had a %s compression ratio of %.2f (%d bytes decoded from %d), expected at least %v", contentEncoding, ratio, len(data), body.wireBytes, cfg.MinCompressionRatio)
+	}
+
+	return nil
+}
+
+// validateBody applies every configured body assertion. All of them must
+// pass, and the first one to fail is reported, checking exact equality, then
+// the substring, the pattern, the JSON path, and the JSON schema.
+func validateBody(cfg *Config, body []byte) error {
+	// Check the exact body, ignoring surrounding whitespace such as a trailing
+	// newline.
+	if len(cfg.ExpectedBodyEquals) != 0 && strings.TrimSpace(string(body)) != strings.TrimSpace(cfg.ExpectedBodyEquals) {
+		return fmt.Errorf("was not %q, got: %s", strings.TrimSpace(cfg.ExpectedBodyEquals), bodySnippet(body))
+	}
+
+	// Check the expected substring.
+	if len(cfg.ExpectedBodyContains) != 0 && !strings.Contains(string(body), cfg.ExpectedBodyContains) {
+		return fmt.Errorf("did not contain %q, got: %s", cfg.ExpectedBodyContains, bodySnippet(body))
+	}
+
+	// Check the expected pattern.
+	if cfg.ExpectedBodyRegex != nil && !cfg.ExpectedBodyRegex.Match(body) {
+		return fmt.Errorf("did not match %q, got: %s", cfg.ExpectedBodyRegex.String(), bodySnippet(body))
+	}
+
+	// Check the expected JSON path.
+	if len(cfg.ExpectedJSONPath) != 0 {
+		value, err := lookupJSONPath(body, cfg.ExpectedJSONPath)
+		if err != nil {
+			return fmt.Errorf("%w, got: %s", err, bodySnippet(body))
+		}
+		actual := formatJSONValue(value)
+		if len(cfg.ExpectedJSONValue) != 0 && actual != cfg.ExpectedJSONValue {
+			return fmt.Errorf("has %q at JSON path %q, expected %q", actual, cfg.ExpectedJSONPath, cfg.ExpectedJSONValue)
+		}
+	}
+
+	// Check the JSON schema.
+	if cfg.ExpectedJSONSchema != nil {
+		err := validateJSONSchema(cfg.ExpectedJSONSchema, body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
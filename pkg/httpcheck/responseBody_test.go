@@ -0,0 +1,275 @@
+package httpcheck
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestValidateBodyEquals checks the exact body match ignores surrounding
+// whitespace on both sides and nothing else.
+func TestValidateBodyEquals(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		body     string
+		wantErr  string
+	}{
+		{name: "exact", expected: "OK", body: "OK"},
+		{name: "trailing newline", expected: "pong", body: "pong\n"},
+		{name: "trailing carriage return and newline", expected: "pong", body: "pong\r\n"},
+		{name: "several trailing newlines", expected: "pong", body: "pong\n\n\n"},
+		{name: "leading whitespace", expected: "pong", body: " \t\npong"},
+		{name: "expected value has a newline", expected: "pong\n", body: "pong"},
+		{name: "inner newline must match", expected: "a\nb", body: "a\nb\n"},
+		{name: "inner whitespace differs", expected: "a b", body: "a  b", wantErr: `was not "a b", got: a  b`},
+		{name: "case differs", expected: "OK", body: "ok\n", wantErr: `was not "OK"`},
+		{name: "longer body", expected: "OK", body: "OK then\n", wantErr: `was not "OK"`},
+		{name: "empty body", expected: "OK", body: "", wantErr: `was not "OK", got: `},
+		{name: "only whitespace", expected: "OK", body: "\n", wantErr: `was not "OK"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.ExpectedBodyEquals = test.expected
+			checkBodyError(t, validateBody(cfg, []byte(test.body)), test.wantErr)
+		})
+	}
+}
+
+// TestValidateBodyOrder checks every body assertion must pass and the first
+// failure is reported in the documented order.
+func TestValidateBodyOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		equals   string
+		contains string
+		regex    string
+		jsonPath string
+		body     string
+		wantErr  string
+	}{
+		{name: "all pass", equals: `{"status":"ok"}`, contains: "ok", regex: `"status"`, jsonPath: "status", body: "{\"status\":\"ok\"}\n"},
+		{name: "equals reported first", equals: "OK", contains: "missing", regex: "missing", body: "nope", wantErr: `was not "OK"`},
+		{name: "contains before regex", contains: "missing", regex: "missing", body: "nope", wantErr: `did not contain "missing"`},
+		{name: "regex before JSON path", regex: "^ok$", jsonPath: "status", body: "nope", wantErr: `did not match "^ok$"`},
+		{name: "later assertion still applies", equals: "nope", contains: "nope", regex: "^yes$", body: "nope\n", wantErr: `did not match "^yes$"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.ExpectedBodyEquals = test.equals
+			cfg.ExpectedBodyContains = test.contains
+			if len(test.regex) != 0 {
+				cfg.ExpectedBodyRegex = regexp.MustCompile(test.regex)
+			}
+			cfg.ExpectedJSONPath = test.jsonPath
+			checkBodyError(t, validateBody(cfg, []byte(test.body)), test.wantErr)
+		})
+	}
+}
+
+// TestRunExpectedBodyEquals checks a health endpoint answering with a
+// trailing newline passes an exact match through a real response.
+func TestRunExpectedBodyEquals(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "pong\n")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		expected string
+		wantPass bool
+	}{
+		{name: "match", expected: "pong", wantPass: true},
+		{name: "mismatch", expected: "ping", wantPass: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newTestConfig(t, server.URL)
+			cfg.ExpectedBodyEquals = test.expected
+			summary := runTestConfig(t, cfg)
+			if summary.Passed(cfg, cfg.Count) != test.wantPass {
+				t.Errorf("passed = %v, want %v, failures: %v", !test.wantPass, test.wantPass, summary.FailureMessages())
+			}
+		})
+	}
+}
+
+// checkBodyError fails the test unless err contains wantErr, or is nil when
+// wantErr is empty.
+func checkBodyError(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	if len(wantErr) == 0 {
+		if err != nil {
+			t.Errorf("got error %v, want none", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("got error %v, want one containing %q", err, wantErr)
+	}
+}
+
+// encodeBody compresses body with the named Content-Encoding, or returns it
+// as is for any other name.
+func encodeBody(t *testing.T, encoding string, body string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(&buffer)
+	case "deflate":
+		writer = zlib.NewWriter(&buffer)
+	default:
+		return []byte(body)
+	}
+	_, err := io.WriteString(writer, body)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		t.Fatalf("error compressing the body: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// TestRunDecompression checks compressed bodies are decoded before the body
+// assertions, whether or not the transport asked for the compression.
+func TestRunDecompression(t *testing.T) {
+	tests := []struct {
+		name             string
+		encoding         string
+		data             []byte
+		acceptEncoding   string
+		expectedEncoding string
+		wantErr          string
+	}{
+		{name: "gzip decoded by the transport", encoding: "gzip"},
+		{name: "gzip requested explicitly", encoding: "gzip", acceptEncoding: "gzip", expectedEncoding: "gzip"},
+		{name: "deflate", encoding: "deflate", acceptEncoding: "deflate", expectedEncoding: "DEFLATE"},
+		{name: "uncompressed", encoding: "identity", acceptEncoding: "identity"},
+		{name: "expected compression missing", encoding: "identity", acceptEncoding: "gzip", expectedEncoding: "gzip", wantErr: `returned Content-Encoding "", expected "gzip"`},
+		{name: "corrupt gzip", encoding: "gzip", data: []byte("not gzip"), acceptEncoding: "gzip", wantErr: "invalid gzip body"},
+		{name: "corrupt deflate", encoding: "deflate", data: []byte("not zlib"), acceptEncoding: "deflate", wantErr: "invalid deflate body"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.data
+			if data == nil {
+				data = encodeBody(t, test.encoding, `{"status":"ok"}`)
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if test.encoding != "identity" {
+					w.Header().Set("Content-Encoding", test.encoding)
+				}
+				_, _ = w.Write(data)
+			}))
+			defer server.Close()
+
+			cfg := newTestConfig(t, server.URL)
+			if len(test.acceptEncoding) != 0 {
+				cfg.Headers = map[string]string{"Accept-Encoding": test.acceptEncoding}
+			}
+			cfg.ExpectedContentEncoding = test.expectedEncoding
+			cfg.ExpectedBodyContains = `"status":"ok"`
+			summary := runTestConfig(t, cfg)
+			if len(test.wantErr) == 0 {
+				if !summary.Passed(cfg, cfg.Count) {
+					t.Fatalf("check failed: %v", summary.FailureMessages())
+				}
+				return
+			}
+			if summary.FirstFailure == nil || !strings.Contains(summary.FirstFailure.Err.Error(), test.wantErr) {
+				t.Fatalf("failures = %v, want one containing %q", summary.FailureMessages(), test.wantErr)
+			}
+		})
+	}
+}
+
+// TestReadBody checks bodies past the limit are truncated, and rejected when
+// strict, with the limit applied to the decoded body.
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		body     string
+		limit    int
+		strict   bool
+		want     string
+		wantErr  string
+	}{
+		{name: "under the limit", body: "hello", limit: 10, want: "hello"},
+		{name: "exactly the limit", body: "hello", limit: 5, want: "hello"},
+		{name: "exactly the limit when strict", body: "hello", limit: 5, strict: true, want: "hello"},
+		{name: "truncated", body: "hello world", limit: 5, want: "hello"},
+		{name: "too large when strict", body: "hello world", limit: 5, strict: true, want: "hello", wantErr: "response too large: more than 5 bytes"},
+		{name: "decoded size limited", encoding: "gzip", body: strings.Repeat("a", 100), limit: 10, strict: true, want: strings.Repeat("a", 10), wantErr: "response too large: more than 10 bytes"},
+		{name: "decoded size under the limit", encoding: "deflate", body: strings.Repeat("a", 100), limit: 100, strict: true, want: strings.Repeat("a", 100)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := &http.Response{Header: http.Header{}}
+			data := []byte(test.body)
+			if len(test.encoding) != 0 {
+				response.Header.Set("Content-Encoding", test.encoding)
+				data = encodeBody(t, test.encoding, test.body)
+			}
+			got, err := readBody(response, bytes.NewReader(data), test.limit, test.strict)
+			checkBodyError(t, err, test.wantErr)
+			if string(got) != test.want {
+				t.Errorf("readBody = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestRunMaxBodyBytes checks body assertions only see MaxBodyBytes of the
+// body, and that FailOnLargeBody fails larger bodies outright.
+func TestRunMaxBodyBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("a", 32)+"ready")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		maxBytes    int
+		failOnLarge bool
+		contains    string
+		wantErr     string
+	}{
+		{name: "whole body read", maxBytes: 37, contains: "ready"},
+		{name: "whole body read when strict", maxBytes: 37, failOnLarge: true, contains: "ready"},
+		{name: "assertion past the limit", maxBytes: 32, contains: "ready", wantErr: `did not contain "ready"`},
+		{name: "assertion within the limit", maxBytes: 32, contains: "aaaa"},
+		{name: "too large", maxBytes: 32, failOnLarge: true, contains: "aaaa", wantErr: "response too large: more than 32 bytes"},
+		{name: "default limit", contains: "ready"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newTestConfig(t, server.URL)
+			cfg.MaxBodyBytes = test.maxBytes
+			cfg.FailOnLargeBody = test.failOnLarge
+			cfg.ExpectedBodyContains = test.contains
+			summary := runTestConfig(t, cfg)
+			if len(test.wantErr) == 0 {
+				if !summary.Passed(cfg, cfg.Count) {
+					t.Fatalf("check failed: %v", summary.FailureMessages())
+				}
+				return
+			}
+			if summary.FirstFailure == nil || !strings.Contains(summary.FirstFailure.Err.Error(), test.wantErr) {
+				t.Fatalf("failures = %v, want one containing %q", summary.FailureMessages(), test.wantErr)
+			}
+		})
+	}
+}
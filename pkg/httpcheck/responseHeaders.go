@@ -0,0 +1,70 @@
+package httpcheck
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// validateHeaders checks that every expected header is present with a matching
+// value. An empty or "*" value only requires the header to be present, and a
+// value ending in "*" matches by prefix.
+func validateHeaders(expected map[string]string, actual http.Header) error {
+	// Check the headers in a stable order so failures are reproducible.
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		want := expected[name]
+		values := actual.Values(name)
+		if len(values) == 0 {
+			return fmt.Errorf("missing expected header %s", http.CanonicalHeaderKey(name))
+		}
+		if !headerValueMatches(want, values) {
+			return fmt.Errorf("header %s was %q, expected %q", http.CanonicalHeaderKey(name), strings.Join(values, ", "), want)
+		}
+	}
+
+	return nil
+}
+
+// validateForbiddenHeaders checks that none of the forbidden headers is
+// present, reporting the first one found in the configured order with its
+// value redacted when sensitive.
+func validateForbiddenHeaders(forbidden []string, actual http.Header) error {
+	// Fail on the first forbidden header present.
+	for _, name := range forbidden {
+		if len(actual.Values(name)) == 0 {
+			continue
+		}
+		name = http.CanonicalHeaderKey(name)
+		value := redactResponseHeaders(http.Header{name: actual.Values(name)})[name]
+		return fmt.Errorf("returned forbidden header %s: %q", name, value)
+	}
+
+	return nil
+}
+
+// headerValueMatches reports whether any of values satisfies want.
+func headerValueMatches(want string, values []string) bool {
+	// Presence is enough for an empty or bare wildcard value.
+	if len(want) == 0 || want == "*" {
+		return true
+	}
+
+	prefix, isPrefix := strings.CutSuffix(want, "*")
+	for _, value := range values {
+		if isPrefix && strings.HasPrefix(value, prefix) {
+			return true
+		}
+		if value == want {
+			return true
+		}
+	}
+
+	return false
+}
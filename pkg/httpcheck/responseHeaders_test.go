@@ -0,0 +1,79 @@
+package httpcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestValidateHeaders checks expected headers match by presence, exact value,
+// or prefix, case-insensitively by name and against any repeated value.
+func TestValidateHeaders(t *testing.T) {
+	actual := http.Header{
+		"Content-Type":  {"application/json; charset=utf-8"},
+		"Cache-Control": {"no-store"},
+		"Vary":          {"Accept", "Origin"},
+		"X-Empty":       {""},
+	}
+	tests := []struct {
+		name     string
+		expected map[string]string
+		wantErr  string
+	}{
+		{name: "none expected", expected: map[string]string{}},
+		{name: "exact", expected: map[string]string{"Cache-Control": "no-store"}},
+		{name: "name case", expected: map[string]string{"cache-control": "no-store"}},
+		{name: "presence", expected: map[string]string{"Content-Type": ""}},
+		{name: "wildcard presence", expected: map[string]string{"Content-Type": "*"}},
+		{name: "empty value present", expected: map[string]string{"X-Empty": ""}},
+		{name: "prefix", expected: map[string]string{"Content-Type": "application/json*"}},
+		{name: "any repeated value", expected: map[string]string{"Vary": "Origin"}},
+		{name: "missing", expected: map[string]string{"x-request-id": "*"}, wantErr: "missing expected header X-Request-Id"},
+		{name: "value case matters", expected: map[string]string{"Cache-Control": "No-Store"}, wantErr: `header Cache-Control was "no-store", expected "No-Store"`},
+		{name: "exact needs the whole value", expected: map[string]string{"Content-Type": "application/json"}, wantErr: `header Content-Type was "application/json; charset=utf-8"`},
+		{name: "prefix mismatch", expected: map[string]string{"Content-Type": "text/*"}, wantErr: `expected "text/*"`},
+		{name: "repeated values listed", expected: map[string]string{"Vary": "Cookie"}, wantErr: `header Vary was "Accept, Origin", expected "Cookie"`},
+		{name: "first failure in name order", expected: map[string]string{"B-Missing": "", "A-Missing": ""}, wantErr: "missing expected header A-Missing"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkBodyError(t, validateHeaders(test.expected, actual), test.wantErr)
+		})
+	}
+}
+
+// TestRunExpectedResponseHeaders checks header assertions apply to real
+// responses and name the request in the failure.
+func TestRunExpectedResponseHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Version", "v1.2.3")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		expected map[string]string
+		wantErr  string
+	}{
+		{name: "match", expected: map[string]string{"X-Version": "v1.*"}},
+		{name: "mismatch", expected: map[string]string{"X-Version": "v2.*"}, wantErr: `GET to ` + server.URL + ` header X-Version was "v1.2.3", expected "v2.*"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := newTestConfig(t, server.URL)
+			cfg.ExpectedResponseHeaders = test.expected
+			summary := runTestConfig(t, cfg)
+			if len(test.wantErr) == 0 {
+				if !summary.Passed(cfg, cfg.Count) {
+					t.Fatalf("check failed: %v", summary.FailureMessages())
+				}
+				return
+			}
+			if summary.FirstFailure == nil || !strings.Contains(summary.FirstFailure.Err.Error(), test.wantErr) {
+				t.Fatalf("failures = %v, want one containing %q", summary.FailureMessages(), test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package httpcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// login sends the configured login request and stores the returned cookies in
+// a jar on client so every later request carries the session.
+func login(ctx context.Context, client *http.Client, cfg *Config) error {
+	// Attach a jar to capture Set-Cookie headers.
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return fmt.Errorf("error creating cookie jar: %w", err)
+	}
+	client.Jar = jar
+
+	// Send the login request with the configured headers and credentials.
+	response, err := CallAPI(ctx, client, APIRequest{
+		URL:               cfg.LoginURL,
+		Type:              cfg.LoginRequestType,
+		Body:              []byte(cfg.LoginRequestBody),
+		Headers:           cfg.Headers,
+		BearerToken:       cfg.BearerToken,
+		BasicAuthUsername: cfg.BasicAuthUsername,
+		BasicAuthPassword: cfg.BasicAuthPassword,
+		Cookies:           cfg.RequestCookies,
+		RedactQueryParams: cfg.RedactQueryParams,
+		Host:              cfg.HostOverride,
+		UserAgent:         cfg.UserAgent,
+	})
+	if err != nil {
+		return fmt.Errorf("login request to %s failed: %w", cfg.RedactURL(cfg.LoginURL), err)
+	}
+	defer closeBody(response)
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("login request to %s returned %d", cfg.RedactURL(cfg.LoginURL), response.StatusCode)
+	}
+
+	// Log the cookie names without their values.
+	names := []string{}
+	for _, cookie := range jar.Cookies(cfg.LoginURL) {
+		names = append(names, cookie.Name)
+	}
+	log.Infoln("Logged in via", cfg.RedactURL(cfg.LoginURL), "and received", len(names), "cookies:", strings.Join(names, ", "))
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package httpcheck
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	// Min is the lowest status code in the range.
+	Min int
+	// Max is the highest status code in the range.
+	Max int
+	// Label is the token the range was parsed from.
+	Label string
+}
+
+// StatusMatcher decides whether a response status code counts as a success.
+type StatusMatcher struct {
+	// Ranges are the accepted status code ranges. Exact codes are stored as
+	// single-value ranges.
+	Ranges []StatusRange
+}
+
+// NewStatusMatcher returns a matcher that accepts exactly the given codes.
+func NewStatusMatcher(statusCodes ...int) *StatusMatcher {
+	// Store each code as a single-value range.
+	matcher := &StatusMatcher{}
+	for _, statusCode := range statusCodes {
+		matcher.Ranges = append(matcher.Ranges, StatusRange{Min: statusCode, Max: statusCode, Label: strconv.Itoa(statusCode)})
+	}
+
+	return matcher
+}
+
+// Matches reports whether statusCode falls inside any configured range.
+func (m *StatusMatcher) Matches(statusCode int) bool {
+	// Check every range for membership.
+	for _, r := range m.Ranges {
+		if statusCode >= r.Min && statusCode <= r.Max {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String renders the matcher using the tokens it was parsed from.
+func (m *StatusMatcher) String() string {
+	// Join the labels for display, once for tokens that span several ranges.
+	labels := make([]string, 0, len(m.Ranges))
+	for i, r := range m.Ranges {
+		if i > 0 && m.Ranges[i-1].Label == r.Label {
+			continue
+		}
+		labels = append(labels, r.Label)
+	}
+
+	return strings.Join(labels, ", ")
+}
+
+// ParseStatusMatcher parses a comma-separated list of exact codes (200),
+// ranges (200-299), class shorthands (2xx), and class exclusions (non-5xx). A
+// status matching any token counts as a success. A zero code is ignored so
+// that EXPECTED_STATUS_CODE=0 keeps selecting the default.
+func ParseStatusMatcher(raw string) (*StatusMatcher, error) {
+	// Parse each token into a range.
+	matcher := &StatusMatcher{}
+	for _, token := range strings.Split(raw, ",") {
+		token = strings.TrimSpace(token)
+		if len(token) == 0 {
+			continue
+		}
+
+		// Expand class exclusions into the ranges around the class.
+		lower := strings.ToLower(token)
+		if excluded, isExclusion := strings.CutPrefix(lower, "non-"); isExclusion {
+			ranges, err := parseStatusExclusion(excluded, lower)
+			if err != nil {
+				return nil, err
+			}
+			matcher.Ranges = append(matcher.Ranges, ranges...)
+			continue
+		}
+
+		r, err := parseStatusRange(token)
+		if err != nil {
+			return nil, err
+		}
+		if r.Max == 0 {
+			continue
+		}
+		matcher.Ranges = append(matcher.Ranges, r)
+	}
+
+	return matcher, nil
+}
+
+// The bounds of the three-digit status codes a server can send.
+const (
+	// lowestStatus is the lowest valid HTTP status code.
+	lowestStatus = 100
+	// highestStatus is the highest three-digit HTTP status code.
+	highestStatus = 999
+)
+
+// parseStatusExclusion parses the class of a non-Nxx token into the ranges of
+// valid status codes below and above that class, labeled with label.
+func parseStatusExclusion(class string, label string) ([]StatusRange, error) {
+	// Only class shorthands can be excluded, not codes or explicit ranges.
+	if len(class) != 3 || !strings.HasSuffix(class, "xx") {
+		return nil, fmt.Errorf("invalid status exclusion %q, expected non-1xx through non-5xx", label)
+	}
+	excluded, err := parseStatusRange(class)
+	if err != nil {
+		return nil, fmt.Errorf("invalid status exclusion %q, expected non-1xx through non-5xx", label)
+	}
+
+	// Accept every valid code outside the class.
+	ranges := []StatusRange{}
+	if excluded.Min > lowestStatus {
+		ranges = append(ranges, StatusRange{Min: lowestStatus, Max: excluded.Min - 1, Label: label})
+	}
+	ranges = append(ranges, StatusRange{Min: excluded.Max + 1, Max: highestStatus, Label: label})
+
+	return ranges, nil
+}
+
+// parseStatusRange parses a single status code token.
+func parseStatusRange(token string) (StatusRange, error) {
+	// Handle class shorthands like 2xx.
+	lower := strings.ToLower(token)
+	if len(lower) == 3 && strings.HasSuffix(lower, "xx") {
+		class, err := strconv.Atoi(lower[:1])
+		if err != nil || class < 1 || class > 5 {
+			return StatusRange{}, fmt.Errorf("invalid status class %q, expected 1xx through 5xx", token)
+		}
+		return StatusRange{Min: class * 100, Max: class*100 + 99, Label: lower}, nil
+	}
+
+	// Handle explicit ranges like 200-299.
+	low, high, isRange := strings.Cut(token, "-")
+	if isRange {
+		minValue, err := strconv.Atoi(strings.TrimSpace(low))
+		if err != nil {
+			return StatusRange{}, fmt.Errorf("error converting status range %q start to int: %w", token, err)
+		}
+		maxValue, err := strconv.Atoi(strings.TrimSpace(high))
+		if err != nil {
+			return StatusRange{}, fmt.Errorf("error converting status range %q end to int: %w", token, err)
+		}
+		if minValue > maxValue {
+			return StatusRange{}, fmt.Errorf("invalid status range %q: start is greater than end", token)
+		}
+		return StatusRange{Min: minValue, Max: maxValue, Label: fmt.Sprintf("%d-%d", minValue, maxValue)}, nil
+	}
+
+	// Handle exact codes.
+	statusValue, err := strconv.Atoi(token)
+	if err != nil {
+		return StatusRange{}, fmt.Errorf("error converting status code %q to int: %w", token, err)
+	}
+
+	return StatusRange{Min: statusValue, Max: statusValue, Label: strconv.Itoa(statusValue)}, nil
+}
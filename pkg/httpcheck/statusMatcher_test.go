@@ -0,0 +1,82 @@
+package httpcheck
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseStatusMatcher checks exact codes, ranges, class shorthands, and
+// class exclusions are parsed into matchers that accept exactly the listed
+// codes.
+func TestParseStatusMatcher(t *testing.T) {
+	tests := []struct {
+		name       string
+		raw        string
+		accept     []int
+		reject     []int
+		wantString string
+		wantErr    string
+	}{
+		{name: "exact code", raw: "200", accept: []int{200}, reject: []int{201, 204, 500}, wantString: "200"},
+		{name: "list", raw: "200, 204,301", accept: []int{200, 204, 301}, reject: []int{201, 302}, wantString: "200, 204, 301"},
+		{name: "range", raw: "200-299", accept: []int{200, 250, 299}, reject: []int{199, 300}, wantString: "200-299"},
+		{name: "range with spaces", raw: "300 - 302", accept: []int{300, 302}, reject: []int{303}, wantString: "300-302"},
+		{name: "class", raw: "2xx", accept: []int{200, 299}, reject: []int{199, 300}, wantString: "2xx"},
+		{name: "upper case class", raw: "5XX", accept: []int{500, 599}, reject: []int{499}, wantString: "5xx"},
+		{name: "mixed", raw: "2xx,304,400-404", accept: []int{204, 304, 401}, reject: []int{301, 405}, wantString: "2xx, 304, 400-404"},
+		{name: "empty tokens skipped", raw: ",200,,", accept: []int{200}, wantString: "200"},
+		{name: "zero ignored", raw: "0", reject: []int{0, 200}, wantString: ""},
+		{name: "not a server error", raw: "non-5xx", accept: []int{100, 200, 404, 600, 999}, reject: []int{500, 599}, wantString: "non-5xx"},
+		{name: "not a client error", raw: "NON-4xx", accept: []int{399, 500}, reject: []int{400, 499}, wantString: "non-4xx"},
+		{name: "not informational", raw: "non-1xx", accept: []int{200}, reject: []int{100, 199}, wantString: "non-1xx"},
+		{name: "exclusion with a list", raw: "non-5xx,503", accept: []int{200, 503}, reject: []int{500}, wantString: "non-5xx, 503"},
+		{name: "exclusion of a code", raw: "non-500", wantErr: `invalid status exclusion "non-500", expected non-1xx through non-5xx`},
+		{name: "exclusion of a bad class", raw: "non-6xx", wantErr: `invalid status exclusion "non-6xx"`},
+		{name: "exclusion of a range", raw: "non-200-299", wantErr: `invalid status exclusion "non-200-299", expected non-1xx through non-5xx`},
+		{name: "exclusion of a narrow range", raw: "non-500-503", wantErr: `invalid status exclusion "non-500-503"`},
+		{name: "bad class", raw: "6xx", wantErr: `invalid status class "6xx", expected 1xx through 5xx`},
+		{name: "class without a digit", raw: "axx", wantErr: `invalid status class "axx"`},
+		{name: "reversed range", raw: "299-200", wantErr: `invalid status range "299-200": start is greater than end`},
+		{name: "bad range start", raw: "x-200", wantErr: `error converting status range "x-200" start to int`},
+		{name: "bad range end", raw: "200-y", wantErr: `error converting status range "200-y" end to int`},
+		{name: "not a number", raw: "ok", wantErr: `error converting status code "ok" to int`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matcher, err := ParseStatusMatcher(test.raw)
+			if len(test.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("ParseStatusMatcher(%q) error = %v, want one containing %q", test.raw, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseStatusMatcher(%q) returned an error: %v", test.raw, err)
+			}
+			for _, statusCode := range test.accept {
+				if !matcher.Matches(statusCode) {
+					t.Errorf("%q rejects %d", test.raw, statusCode)
+				}
+			}
+			for _, statusCode := range test.reject {
+				if matcher.Matches(statusCode) {
+					t.Errorf("%q accepts %d", test.raw, statusCode)
+				}
+			}
+			if matcher.String() != test.wantString {
+				t.Errorf("String = %q, want %q", matcher.String(), test.wantString)
+			}
+		})
+	}
+}
+
+// TestNewStatusMatcher checks the default matcher accepts only its codes.
+func TestNewStatusMatcher(t *testing.T) {
+	matcher := NewStatusMatcher(200, 204)
+	if !matcher.Matches(200) || !matcher.Matches(204) || matcher.Matches(201) {
+		t.Errorf("NewStatusMatcher(200, 204) matches the wrong codes")
+	}
+	if matcher.String() != "200, 204" {
+		t.Errorf("String = %q, want %q", matcher.String(), "200, 204")
+	}
+}
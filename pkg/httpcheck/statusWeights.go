@@ -0,0 +1,78 @@
+package httpcheck
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// scoreScale converts weights to integer thousandths so scores add up
+// without floating point error.
+const scoreScale = 1000
+
+// StatusWeight assigns a score to responses whose status falls in Range.
+type StatusWeight struct {
+	// Range is the status codes the weight applies to.
+	Range StatusRange
+	// Weight is the score between 0 and 1 a matching response earns.
+	Weight float64
+}
+
+// ParseStatusWeights parses a comma-separated list of status=weight entries
+// such as "200=1,429=0.5,5xx=0". Statuses use the same exact, range, and class
+// forms as ParseStatusMatcher.
+func ParseStatusWeights(raw string) ([]StatusWeight, error) {
+	// Parse each entry into a range and a weight.
+	weights := []StatusWeight{}
+	for index, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+
+		status, weightText, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("malformed status weight entry %d, expected \"status=weight\"", index+1)
+		}
+		r, err := parseStatusRange(strings.TrimSpace(status))
+		if err != nil {
+			return nil, err
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightText), 64)
+		if err != nil {
+			return nil, fmt.Errorf("error converting weight for status %s to float: %w", r.Label, err)
+		}
+		if !(weight >= 0 && weight <= 1) {
+			return nil, fmt.Errorf("weight for status %s must be between 0 and 1, got %v", r.Label, weight)
+		}
+		weights = append(weights, StatusWeight{Range: r, Weight: weight})
+	}
+
+	return weights, nil
+}
+
+// resultWeight returns the score a check earns. The first matching status
+// weight applies whenever the check got a response. Otherwise a passing check
+// earns 1 and a failing one earns 0.
+func resultWeight(weights []StatusWeight, result Result) float64 {
+	// Look up the status in the configured weights.
+	if result.StatusCode != 0 {
+		for _, weight := range weights {
+			if result.StatusCode >= weight.Range.Min && result.StatusCode <= weight.Range.Max {
+				return weight.Weight
+			}
+		}
+	}
+
+	// Fall back to binary pass or fail.
+	if result.Err != nil {
+		return 0
+	}
+	return 1
+}
+
+// scaledScore converts a weight to integer thousandths.
+func scaledScore(weight float64) int {
+	return int(math.Round(weight * scoreScale))
+}
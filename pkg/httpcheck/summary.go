@@ -0,0 +1,453 @@
+package httpcheck
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Summary reports the results of a run.
+type Summary struct {
+	// ChecksRan is the total number of checks.
+	ChecksRan int
+	// ChecksPassed is the number of successful checks.
+	ChecksPassed int
+	// ChecksFailed is the number of failed checks.
+	ChecksFailed int
+	// Score is the sum of every check's weight. Without status weights it
+	// equals ChecksPassed.
+	Score float64
+	// MinDuration is the fastest response time.
+	MinDuration time.Duration
+	// MaxDuration is the slowest response time.
+	MaxDuration time.Duration
+	// MeanDuration is the average response time.
+	MeanDuration time.Duration
+	// P95Duration is the 95th percentile response time.
+	P95Duration time.Duration
+	// P99Duration is the 99th percentile response time.
+	P99Duration time.Duration
+	// MinTTFB is the shortest time to first byte.
+	MinTTFB time.Duration
+	// MaxTTFB is the longest time to first byte.
+	MaxTTFB time.Duration
+	// MeanTTFB is the average time to first byte.
+	MeanTTFB time.Duration
+	// P95TTFB is the 95th percentile time to first byte.
+	P95TTFB time.Duration
+	// P99TTFB is the 99th percentile time to first byte.
+	P99TTFB time.Duration
+
+	// StatusCodes counts the responses received with each status code.
+	StatusCodes map[int]int
+	// ErrorCategories counts the requests that got no response, or a refused
+	// WebSocket upgrade, by the kind of failure.
+	ErrorCategories map[ErrorCategory]int
+	// FailureReasons counts each distinct failure message.
+	FailureReasons map[string]int
+	// URLResults holds the per-URL counts keyed by redacted URL.
+	URLResults map[string]*URLResult
+	// RotatedValueResults holds the counts for each RotateHeader value.
+	RotatedValueResults map[string]*URLResult
+	// FirstFailure is the first check that failed, or nil when none did.
+	FirstFailure *Result
+	// SuccessValue is the value extracted at SuccessJSONPath from the last
+	// successful response that had one.
+	SuccessValue string
+	// RequestBytes is the total size of the request bodies sent.
+	RequestBytes int64
+	// ResponseBytes is the total number of response body bytes read.
+	ResponseBytes int64
+	// TrailingChecks is the number of checks in the trailing window, which
+	// is fewer than TrailingWindow when fewer checks ran.
+	TrailingChecks int
+	// TrailingFailed is the number of failed checks in the trailing window.
+	TrailingFailed int
+
+	// mu guards the summary while workers record results.
+	mu sync.Mutex
+	// urlOrder holds the redacted URLs in first-seen order.
+	urlOrder []string
+	// rotatedValueOrder holds the RotateHeader values in first-seen order.
+	rotatedValueOrder []string
+	// failureOrder holds the distinct failure messages in first-seen order.
+	failureOrder []string
+	// durations holds the response time of every request that got a response.
+	durations []time.Duration
+	// ttfbs holds the time to first byte of every request that got a
+	// response.
+	ttfbs []time.Duration
+	// scaledScore is Score in thousandths, summed without rounding error.
+	scaledScore int
+	// trailing is a ring buffer of whether each of the last TrailingWindow
+	// checks failed, in the order they completed.
+	trailing []bool
+	// trailingNext is the trailing slot the next check is written to.
+	trailingNext int
+}
+
+// URLResult holds the check counts for a single URL.
+type URLResult struct {
+	// ChecksRan is the number of checks against the URL.
+	ChecksRan int
+	// ChecksFailed is the number of failed checks against the URL.
+	ChecksFailed int
+}
+
+// record adds the outcome of a single request to the summary. It reports
+// whether the request failed for a reason not seen before.
+func (s *Summary) record(result Result) bool {
+	// Count the check.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ChecksRan++
+	s.scaledScore += scaledScore(result.Weight)
+	s.RequestBytes += result.RequestBytes
+	s.ResponseBytes += result.ResponseBytes
+	firstFailure := false
+	perURL := s.urlResult(result.URL)
+	perURL.ChecksRan++
+	perValue := s.rotatedValueResult(result.RotatedValue)
+	perValue.ChecksRan++
+	if len(s.trailing) != 0 {
+		s.trailing[s.trailingNext] = result.Err != nil
+		s.trailingNext = (s.trailingNext + 1) % len(s.trailing)
+	}
+	if result.Err != nil {
+		perURL.ChecksFailed++
+		perValue.ChecksFailed++
+		s.ChecksFailed++
+		firstFailure = s.recordFailure(result.Err.Error())
+		if s.FirstFailure == nil {
+			first := result
+			s.FirstFailure = &first
+		}
+		if len(result.ErrorCategory) != 0 {
+			if s.ErrorCategories == nil {
+				s.ErrorCategories = make(map[ErrorCategory]int)
+			}
+			s.ErrorCategories[result.ErrorCategory]++
+		}
+	} else {
+		s.ChecksPassed++
+		if len(result.SuccessValue) != 0 {
+			s.SuccessValue = result.SuccessValue
+		}
+	}
+
+	// Only requests that received a response contribute to the status and
+	// latency stats.
+	if result.StatusCode == 0 {
+		return firstFailure
+	}
+	if s.StatusCodes == nil {
+		s.StatusCodes = make(map[int]int)
+	}
+	s.StatusCodes[result.StatusCode]++
+	s.durations = append(s.durations, result.Duration)
+	if result.Timing.TTFB > 0 {
+		s.ttfbs = append(s.ttfbs, result.Timing.TTFB)
+	}
+
+	return firstFailure
+}
+
+// urlResult returns the counts for the given URL, creating them when needed.
+func (s *Summary) urlResult(redactedURL string) *URLResult {
+	// Create the entry on first use.
+	if s.URLResults == nil {
+		s.URLResults = make(map[string]*URLResult)
+	}
+	perURL, ok := s.URLResults[redactedURL]
+	if !ok {
+		perURL = &URLResult{}
+		s.URLResults[redactedURL] = perURL
+		s.urlOrder = append(s.urlOrder, redactedURL)
+	}
+
+	return perURL
+}
+
+// rotatedValueResult returns the counts for the given RotateHeader value,
+// creating them when needed. Requests sent without a rotated value share a
+// scratch entry that is never reported.
+func (s *Summary) rotatedValueResult(value string) *URLResult {
+	// Skip requests without a rotated value.
+	if len(value) == 0 {
+		return &URLResult{}
+	}
+
+	// Create the entry on first use.
+	if s.RotatedValueResults == nil {
+		s.RotatedValueResults = make(map[string]*URLResult)
+	}
+	perValue, ok := s.RotatedValueResults[value]
+	if !ok {
+		perValue = &URLResult{}
+		s.RotatedValueResults[value] = perValue
+		s.rotatedValueOrder = append(s.rotatedValueOrder, value)
+	}
+
+	return perValue
+}
+
+// RotatedValueMessages describes how many checks failed with each
+// RotateHeader value, including values that never failed, so one unhealthy
+// backend stands out from the rest.
+func (s *Summary) RotatedValueMessages(header string) []string {
+	// Render the values in first-seen order.
+	messages := []string{}
+	for _, value := range s.rotatedValueOrder {
+		perValue := s.RotatedValueResults[value]
+		messages = append(messages, fmt.Sprintf("%s=%s: %d of %d checks failed", header, value, perValue.ChecksFailed, perValue.ChecksRan))
+	}
+
+	return messages
+}
+
+// URLFailureMessages describes how many checks failed against each URL that
+// had at least one failure.
+func (s *Summary) URLFailureMessages() []string {
+	// Render the URLs in first-seen order.
+	messages := []string{}
+	for _, redactedURL := range s.urlOrder {
+		perURL := s.URLResults[redactedURL]
+		if perURL.ChecksFailed == 0 {
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("%s: %d of %d checks failed", redactedURL, perURL.ChecksFailed, perURL.ChecksRan))
+	}
+
+	return messages
+}
+
+// FirstFailureMessages describes the first failed check: its error and, when
+// it got a response, the status code, headers, and start of the body. It
+// returns nil when no check failed.
+func (s *Summary) FirstFailureMessages() []string {
+	// Skip when every check passed.
+	first := s.FirstFailure
+	if first == nil {
+		return nil
+	}
+	messages := []string{"first failure: " + first.Err.Error()}
+	if first.StatusCode == 0 {
+		return messages
+	}
+
+	// Render the headers in a stable order.
+	headers := make([]string, 0, len(first.ResponseHeaders))
+	for name, value := range first.ResponseHeaders {
+		headers = append(headers, name+": "+value)
+	}
+	sort.Strings(headers)
+	messages = append(messages,
+		fmt.Sprintf("first failure status: %d", first.StatusCode),
+		"first failure headers: "+strings.Join(headers, "; "),
+		"first failure body: "+first.BodySnippet,
+	)
+
+	return messages
+}
+
+// StatusCodeMessage describes how many responses carried each status code,
+// such as "status codes: 200=8, 503=2". It returns an empty string when no
+// request got a response.
+func (s *Summary) StatusCodeMessage() string {
+	// Render the codes in ascending order.
+	if len(s.StatusCodes) == 0 {
+		return ""
+	}
+	codes := make([]int, 0, len(s.StatusCodes))
+	for code := range s.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	entries := make([]string, 0, len(codes))
+	for _, code := range codes {
+		entries = append(entries, fmt.Sprintf("%d=%d", code, s.StatusCodes[code]))
+	}
+
+	return "status codes: " + strings.Join(entries, ", ")
+}
+
+// ErrorCategoryMessage describes how many requests failed without a response
+// in each error category, such as "error categories: dns=3, timeout=1". It
+// returns an empty string when every request got a response.
+func (s *Summary) ErrorCategoryMessage() string {
+	// Render the categories in name order.
+	if len(s.ErrorCategories) == 0 {
+		return ""
+	}
+	categories := make([]string, 0, len(s.ErrorCategories))
+	for category := range s.ErrorCategories {
+		categories = append(categories, string(category))
+	}
+	sort.Strings(categories)
+	entries := make([]string, 0, len(categories))
+	for _, category := range categories {
+		entries = append(entries, fmt.Sprintf("%s=%d", category, s.ErrorCategories[ErrorCategory(category)]))
+	}
+
+	return "error categories: " + strings.Join(entries, ", ")
+}
+
+// recordFailure counts a failure message, remembering the order reasons first
+// appear. It reports whether the reason is new.
+func (s *Summary) recordFailure(reason string) bool {
+	// Track first occurrences so the report is stable.
+	if s.FailureReasons == nil {
+		s.FailureReasons = make(map[string]int)
+	}
+	first := s.FailureReasons[reason] == 0
+	if first {
+		s.failureOrder = append(s.failureOrder, reason)
+	}
+	s.FailureReasons[reason]++
+
+	return first
+}
+
+// FailureMessages returns each distinct failure reason prefixed with its count,
+// such as "3x connection refused".
+func (s *Summary) FailureMessages() []string {
+	// Render the reasons in first-seen order.
+	messages := make([]string, 0, len(s.failureOrder))
+	for _, reason := range s.failureOrder {
+		messages = append(messages, fmt.Sprintf("%dx %s", s.FailureReasons[reason], reason))
+	}
+
+	return messages
+}
+
+// repeatedFailureMessages returns the FailureMessages entries for reasons that
+// occurred more than once.
+func (s *Summary) repeatedFailureMessages() []string {
+	// Keep the first-seen order.
+	messages := []string{}
+	for _, reason := range s.failureOrder {
+		if s.FailureReasons[reason] > 1 {
+			messages = append(messages, fmt.Sprintf("%dx %s", s.FailureReasons[reason], reason))
+		}
+	}
+
+	return messages
+}
+
+// HasLatency reports whether any request received a response, in which case
+// the latency statistics are populated.
+func (s *Summary) HasLatency() bool {
+	return len(s.durations) != 0
+}
+
+// MeetsPassingPercent reports whether the score reaches passingPercent of
+// totalChecks. For unweighted checks this matches comparing ChecksPassed with
+// PassingThreshold, and weighted scores are compared exactly.
+func (s *Summary) MeetsPassingPercent(passingPercent int, totalChecks int) bool {
+	return s.scaledScore*100 >= passingPercent*totalChecks*scoreScale
+}
+
+// Passed reports whether the run meets the pass criteria of cfg.
+// PassOnAnySuccess takes precedence over a MaxFailures limit, which takes
+// precedence over PassingPercent.
+func (s *Summary) Passed(cfg *Config, totalChecks int) bool {
+	// Settle for a single pass, or compare the failure count when a limit is
+	// set.
+	if cfg.PassOnAnySuccess {
+		return s.ChecksPassed >= 1
+	}
+	if cfg.MaxFailures >= 0 {
+		return s.ChecksFailed <= cfg.MaxFailures
+	}
+
+	return s.MeetsPassingPercent(cfg.PassingPercent, totalChecks)
+}
+
+// TrailingWindowPassed reports whether every check in the trailing window
+// passed. It is always true without a TrailingWindow.
+func (s *Summary) TrailingWindowPassed() bool {
+	return s.TrailingFailed == 0
+}
+
+// canStillPass reports whether the run could still meet the pass criteria of
+// cfg if every check not yet recorded earned the full weight.
+func (s *Summary) canStillPass(cfg *Config, totalChecks int) bool {
+	// Credit the unrecorded checks, including those in flight, with a pass.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cfg.PassOnAnySuccess {
+		return true
+	}
+	if cfg.MaxFailures >= 0 {
+		return s.ChecksFailed <= cfg.MaxFailures
+	}
+	bestScore := s.scaledScore + (totalChecks-s.ChecksRan)*scoreScale
+
+	return bestScore*100 >= cfg.PassingPercent*totalChecks*scoreScale
+}
+
+// finish calculates the score and latency statistics once every request is
+// recorded.
+func (s *Summary) finish() {
+	// Convert the score back to checks.
+	s.Score = float64(s.scaledScore) / scoreScale
+
+	// Count the failures in the trailing window.
+	s.TrailingChecks = min(s.ChecksRan, len(s.trailing))
+	s.TrailingFailed = 0
+	for _, failed := range s.trailing {
+		if failed {
+			s.TrailingFailed++
+		}
+	}
+
+	// Summarize the response times and times to first byte.
+	s.MinDuration, s.MaxDuration, s.MeanDuration, s.P95Duration, s.P99Duration = durationStats(s.durations)
+	s.MinTTFB, s.MaxTTFB, s.MeanTTFB, s.P95TTFB, s.P99TTFB = durationStats(s.ttfbs)
+}
+
+// HasTTFB reports whether any time to first byte was recorded, in which case
+// the TTFB statistics are populated.
+func (s *Summary) HasTTFB() bool {
+	return len(s.ttfbs) != 0
+}
+
+// durationStats returns the minimum, maximum, mean, and 95th and 99th
+// percentiles of durations, or zeros when there are none.
+func durationStats(durations []time.Duration) (time.Duration, time.Duration, time.Duration, time.Duration, time.Duration) {
+	// Skip the stats when nothing was recorded.
+	if len(durations) == 0 {
+		return 0, 0, 0, 0, 0
+	}
+
+	// Sort a copy so the recorded order is preserved.
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, duration := range sorted {
+		total += duration
+	}
+
+	return sorted[0], sorted[len(sorted)-1], total / time.Duration(len(sorted)), percentile(sorted, 95), percentile(sorted, 99)
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	// Nearest rank is ceil(p/100 * n), expressed as a 1-based index.
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+
+	return sorted[rank-1]
+}
@@ -0,0 +1,141 @@
+package httpcheck
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newRecordedSummary returns a summary holding passed passing and failed
+// failing unweighted checks.
+func newRecordedSummary(passed int, failed int) *Summary {
+	summary := &Summary{}
+	for i := 0; i < passed; i++ {
+		summary.record(Result{Weight: 1})
+	}
+	for i := 0; i < failed; i++ {
+		summary.record(Result{Err: errors.New("got a 503")})
+	}
+	return summary
+}
+
+// TestSummaryPassed checks PassOnAnySuccess takes precedence over
+// MaxFailures, which takes precedence over PassingPercent.
+func TestSummaryPassed(t *testing.T) {
+	tests := []struct {
+		name             string
+		passingPercent   int
+		maxFailures      int
+		passOnAnySuccess bool
+		passed           int
+		failed           int
+		want             bool
+	}{
+		// PassingPercent alone.
+		{name: "percent met exactly", passingPercent: 80, maxFailures: -1, passed: 8, failed: 2, want: true},
+		{name: "percent missed", passingPercent: 80, maxFailures: -1, passed: 7, failed: 3, want: false},
+		{name: "percent rounds up", passingPercent: 50, maxFailures: -1, passed: 1, failed: 2, want: false},
+		{name: "zero percent", passingPercent: 0, maxFailures: -1, passed: 0, failed: 3, want: true},
+
+		// MaxFailures overrides PassingPercent.
+		{name: "no failures allowed", passingPercent: 0, maxFailures: 0, passed: 9, failed: 1, want: false},
+		{name: "no failures allowed and none failed", passingPercent: 100, maxFailures: 0, passed: 10, want: true},
+		{name: "failures within the limit below the percent", passingPercent: 100, maxFailures: 2, passed: 8, failed: 2, want: true},
+		{name: "failures over the limit above the percent", passingPercent: 50, maxFailures: 2, passed: 7, failed: 3, want: false},
+		{name: "limit above the total", passingPercent: 100, maxFailures: 10, passed: 0, failed: 3, want: true},
+
+		// PassOnAnySuccess overrides both.
+		{name: "any success over the limit", passingPercent: 100, maxFailures: 0, passOnAnySuccess: true, passed: 1, failed: 9, want: true},
+		{name: "any success without a pass", passingPercent: 0, maxFailures: 10, passOnAnySuccess: true, passed: 0, failed: 3, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.PassingPercent = test.passingPercent
+			cfg.MaxFailures = test.maxFailures
+			cfg.PassOnAnySuccess = test.passOnAnySuccess
+			summary := newRecordedSummary(test.passed, test.failed)
+			got := summary.Passed(cfg, test.passed+test.failed)
+			if got != test.want {
+				t.Errorf("Passed = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestSummaryCanStillPass checks the early exit decision credits every
+// unrecorded check with a pass and follows the same precedence as Passed.
+func TestSummaryCanStillPass(t *testing.T) {
+	tests := []struct {
+		name             string
+		passingPercent   int
+		maxFailures      int
+		passOnAnySuccess bool
+		passed           int
+		failed           int
+		totalChecks      int
+		want             bool
+	}{
+		{name: "nothing recorded", passingPercent: 100, maxFailures: -1, totalChecks: 10, want: true},
+		{name: "remaining checks can reach the percent", passingPercent: 80, maxFailures: -1, passed: 2, failed: 2, totalChecks: 10, want: true},
+		{name: "remaining checks cannot reach the percent", passingPercent: 80, maxFailures: -1, passed: 2, failed: 3, totalChecks: 10, want: false},
+		{name: "one failure fails all checks", passingPercent: 100, maxFailures: -1, failed: 1, totalChecks: 10, want: false},
+		{name: "failures at the limit", passingPercent: 100, maxFailures: 2, failed: 2, totalChecks: 10, want: true},
+		{name: "failures over the limit", passingPercent: 0, maxFailures: 2, failed: 3, totalChecks: 10, want: false},
+		{name: "any success with only failures", passingPercent: 100, maxFailures: 0, passOnAnySuccess: true, failed: 9, totalChecks: 10, want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.PassingPercent = test.passingPercent
+			cfg.MaxFailures = test.maxFailures
+			cfg.PassOnAnySuccess = test.passOnAnySuccess
+			summary := newRecordedSummary(test.passed, test.failed)
+			got := summary.canStillPass(cfg, test.totalChecks)
+			if got != test.want {
+				t.Errorf("canStillPass = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestRunMaxFailuresEarlyExit checks a run stops starting requests once more
+// than MaxFailures checks have failed, even when PassingPercent would still
+// allow a pass.
+func TestRunMaxFailuresEarlyExit(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		maxFailures  int
+		earlyExit    bool
+		wantRequests int64
+	}{
+		{name: "early exit", maxFailures: 1, earlyExit: true, wantRequests: 2},
+		{name: "no early exit", maxFailures: 1, earlyExit: false, wantRequests: 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests.Store(0)
+			cfg := newTestConfig(t, server.URL)
+			cfg.Count = 10
+			cfg.PassingPercent = 0
+			cfg.MaxFailures = test.maxFailures
+			cfg.EarlyExit = test.earlyExit
+			summary := runTestConfig(t, cfg)
+			if summary.Passed(cfg, cfg.Count) {
+				t.Errorf("run passed with %d failures", summary.ChecksFailed)
+			}
+			if requests.Load() != test.wantRequests {
+				t.Errorf("sent %d requests, want %d", requests.Load(), test.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package httpcheck
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// webSocketGUID is appended to the handshake key before hashing, as defined
+// by RFC 6455.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// errWebSocketHandshake marks a response that did not complete the upgrade.
+var errWebSocketHandshake = errors.New("websocket handshake failed")
+
+// WebSocket frame opcodes used by the ping exchange.
+const (
+	webSocketOpClose = 0x8
+	webSocketOpPing  = 0x9
+	webSocketOpPong  = 0xa
+)
+
+// webSocketAPIRequest turns request into a WebSocket upgrade request with a
+// fresh handshake key.
+func webSocketAPIRequest(request APIRequest) APIRequest {
+	// Upgrades are sent as GET requests without a body.
+	request.Type = http.MethodGet
+	request.Body = nil
+	request.IfNoneMatch = ""
+
+	// Ask for the upgrade, letting custom headers add to it.
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+	headers := map[string]string{
+		"Connection":            "Upgrade",
+		"Upgrade":               "websocket",
+		"Sec-WebSocket-Version": "13",
+		"Sec-WebSocket-Key":     base64.StdEncoding.EncodeToString(key),
+	}
+	for name, value := range request.Headers {
+		headers[name] = value
+	}
+	request.Headers = headers
+
+	return request
+}
+
+// validateWebSocket requires a completed WebSocket upgrade and, when
+// WebSocketPing is set, a pong answering a ping. Handshake failures wrap
+// errWebSocketHandshake.
+func validateWebSocket(ctx context.Context, cfg *Config, parsedURL *url.URL, response *http.Response) error {
+	// Require the switch and the accept value derived from our key.
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("%w: got a %d instead of 101 Switching Protocols from %s", errWebSocketHandshake, response.StatusCode, cfg.RedactURL(parsedURL))
+	}
+	if !strings.EqualFold(response.Header.Get("Upgrade"), "websocket") {
+		return fmt.Errorf("%w: %s switched to %q instead of websocket", errWebSocketHandshake, cfg.RedactURL(parsedURL), response.Header.Get("Upgrade"))
+	}
+	expectedAccept := webSocketAccept(response.Request.Header.Get("Sec-WebSocket-Key"))
+	if response.Header.Get("Sec-WebSocket-Accept") != expectedAccept {
+		return fmt.Errorf("%w: %s returned a Sec-WebSocket-Accept that does not match the key", errWebSocketHandshake, cfg.RedactURL(parsedURL))
+	}
+	if !cfg.WebSocketPing {
+		return nil
+	}
+
+	// Exchange a ping, closing the connection to stop a stalled read. A zero
+	// REQUEST_TIMEOUT leaves only the run context as a bound.
+	conn, ok := response.Body.(io.ReadWriter)
+	if !ok {
+		return fmt.Errorf("the upgraded connection to %s cannot be written to", cfg.RedactURL(parsedURL))
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- webSocketPing(conn)
+	}()
+	var timeout <-chan time.Time
+	if cfg.RequestTimeout > 0 {
+		timer := time.NewTimer(time.Duration(cfg.RequestTimeout) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("websocket ping to %s failed: %w", cfg.RedactURL(parsedURL), err)
+		}
+		return nil
+	case <-timeout:
+		_ = response.Body.Close()
+		<-done
+		return fmt.Errorf("websocket ping to %s got no pong within %d seconds", cfg.RedactURL(parsedURL), cfg.RequestTimeout)
+	case <-ctx.Done():
+		_ = response.Body.Close()
+		<-done
+		return fmt.Errorf("websocket ping to %s was cancelled: %w", cfg.RedactURL(parsedURL), ctx.Err())
+	}
+}
+
+// webSocketAccept returns the Sec-WebSocket-Accept value for key.
+func webSocketAccept(key string) string {
+	// Hash the key with the fixed GUID.
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// webSocketPing sends a ping and waits for the matching pong, skipping any
+// data frames that arrive first, then starts a clean close.
+func webSocketPing(conn io.ReadWriter) error {
+	// Send a ping with a random payload so a stale pong cannot match.
+	payload := make([]byte, 8)
+	_, _ = rand.Read(payload)
+	err := writeWebSocketFrame(conn, webSocketOpPing, payload)
+	if err != nil {
+		return fmt.Errorf("error sending ping: %w", err)
+	}
+
+	// Read frames until the pong arrives.
+	for {
+		opcode, data, err := readWebSocketFrame(conn)
+		if err != nil {
+			return fmt.Errorf("error reading frame: %w", err)
+		}
+		switch opcode {
+		case webSocketOpClose:
+			return fmt.Errorf("server closed the connection before answering the ping")
+		case webSocketOpPong:
+			if string(data) != string(payload) {
+				continue
+			}
+			_ = writeWebSocketFrame(conn, webSocketOpClose, []byte{0x03, 0xe8})
+			return nil
+		}
+	}
+}
+
+// writeWebSocketFrame writes a single masked client frame.
+func writeWebSocketFrame(w io.Writer, opcode byte, payload []byte) error {
+	// Control frames always fit the short length form.
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	mask := make([]byte, 4)
+	_, _ = rand.Read(mask)
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := w.Write(frame)
+
+	return err
+}
+
+// maxWebSocketFrameBytes bounds the frames read while waiting for a pong.
+const maxWebSocketFrameBytes = 1 << 20
+
+// readWebSocketFrame reads a single unmasked server frame.
+func readWebSocketFrame(r io.Reader) (byte, []byte, error) {
+	// Read the fixed header and the extended length.
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return 0, nil, err
+	}
+	if header[1]&0x80 != 0 {
+		return 0, nil, fmt.Errorf("server sent a masked frame")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(r, extended)
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		_, err = io.ReadFull(r, extended)
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > maxWebSocketFrameBytes {
+		return 0, nil, fmt.Errorf("frame of %d bytes is larger than %d bytes", length, maxWebSocketFrameBytes)
+	}
+
+	// Read the payload.
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return header[0] & 0x0f, payload, nil
+}
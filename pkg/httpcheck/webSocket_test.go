@@ -0,0 +1,185 @@
+package httpcheck
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+// TestWebSocketAccept checks the accept value against the example in RFC 6455.
+func TestWebSocketAccept(t *testing.T) {
+	got := webSocketAccept("dGhlIHNhbXBsZSBub25jZQ==")
+	if got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("webSocketAccept = %q, want %q", got, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=")
+	}
+}
+
+// hijackWebSocket returns a handler that takes over the connection and lets
+// respond write the raw handshake response and frames, given the client key.
+func hijackWebSocket(t *testing.T, respond func(conn net.Conn, key string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buffered, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("error hijacking the connection: %v", err)
+			return
+		}
+		defer conn.Close()
+		if buffered.Reader.Buffered() != 0 {
+			t.Errorf("client sent data before the handshake completed")
+		}
+		respond(conn, r.Header.Get("Sec-WebSocket-Key"))
+	})
+}
+
+// writeHandshake writes a 101 response with the given Upgrade and accept
+// values.
+func writeHandshake(conn net.Conn, upgrade string, accept string) {
+	_, _ = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: "+upgrade+"\r\nSec-WebSocket-Accept: "+accept+"\r\n\r\n")
+}
+
+// TestRunWebSocket checks WebSocket checks against a known-good server from
+// golang.org/x/net and against misbehaving servers.
+func TestRunWebSocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(t *testing.T) http.Handler
+		ping    bool
+		// wantHandshake expects the failure to be categorized as a handshake
+		// failure.
+		wantHandshake bool
+		wantErr       string
+	}{
+		{
+			name: "upgrade",
+			handler: func(*testing.T) http.Handler {
+				return websocket.Server{Handler: func(ws *websocket.Conn) {
+					_, _ = io.Copy(io.Discard, ws)
+				}}
+			},
+		},
+		{
+			name: "ping answered",
+			handler: func(*testing.T) http.Handler {
+				return websocket.Server{Handler: func(ws *websocket.Conn) {
+					_, _ = io.Copy(io.Discard, ws)
+				}}
+			},
+			ping: true,
+		},
+		{
+			name: "ping answered after a message",
+			handler: func(*testing.T) http.Handler {
+				return websocket.Server{Handler: func(ws *websocket.Conn) {
+					_ = websocket.Message.Send(ws, "hello")
+					_, _ = io.Copy(io.Discard, ws)
+				}}
+			},
+			ping: true,
+		},
+		{
+			name: "upgrade refused",
+			handler: func(*testing.T) http.Handler {
+				// The default handler refuses requests without an Origin.
+				return websocket.Handler(func(*websocket.Conn) {})
+			},
+			wantHandshake: true,
+			wantErr:       "got a 403 instead of 101 Switching Protocols",
+		},
+		{
+			name: "plain HTTP response",
+			handler: func(*testing.T) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					_, _ = io.WriteString(w, "OK")
+				})
+			},
+			wantHandshake: true,
+			wantErr:       "got a 200 instead of 101 Switching Protocols",
+		},
+		{
+			name: "bad accept key",
+			handler: func(t *testing.T) http.Handler {
+				return hijackWebSocket(t, func(conn net.Conn, key string) {
+					writeHandshake(conn, "websocket", webSocketAccept(key+"x"))
+				})
+			},
+			wantHandshake: true,
+			wantErr:       "returned a Sec-WebSocket-Accept that does not match the key",
+		},
+		{
+			name: "switched to another protocol",
+			handler: func(t *testing.T) http.Handler {
+				return hijackWebSocket(t, func(conn net.Conn, key string) {
+					writeHandshake(conn, "h2c", webSocketAccept(key))
+				})
+			},
+			wantHandshake: true,
+			wantErr:       `switched to "h2c" instead of websocket`,
+		},
+		{
+			name: "pong timeout",
+			handler: func(t *testing.T) http.Handler {
+				return hijackWebSocket(t, func(conn net.Conn, key string) {
+					// Complete the handshake, then read without answering.
+					writeHandshake(conn, "websocket", webSocketAccept(key))
+					_, _ = io.Copy(io.Discard, conn)
+				})
+			},
+			ping:    true,
+			wantErr: "got no pong within 1 seconds",
+		},
+		{
+			name: "closed before the pong",
+			handler: func(t *testing.T) http.Handler {
+				return hijackWebSocket(t, func(conn net.Conn, key string) {
+					writeHandshake(conn, "websocket", webSocketAccept(key))
+					_, _ = conn.Write([]byte{0x80 | webSocketOpClose, 0x02, 0x03, 0xe8})
+					_, _ = io.Copy(io.Discard, conn)
+				})
+			},
+			ping:    true,
+			wantErr: "server closed the connection before answering the ping",
+		},
+		{
+			name: "masked server frame",
+			handler: func(t *testing.T) http.Handler {
+				return hijackWebSocket(t, func(conn net.Conn, key string) {
+					writeHandshake(conn, "websocket", webSocketAccept(key))
+					_, _ = conn.Write([]byte{0x80 | webSocketOpPong, 0x80, 0, 0, 0, 0})
+					_, _ = io.Copy(io.Discard, conn)
+				})
+			},
+			ping:    true,
+			wantErr: "server sent a masked frame",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(test.handler(t))
+			defer server.Close()
+
+			cfg := newTestConfig(t, server.URL)
+			cfg.Protocol = ProtocolWebSocket
+			cfg.WebSocketPing = test.ping
+			cfg.RequestTimeout = 1
+			summary := runTestConfig(t, cfg)
+			if len(test.wantErr) == 0 {
+				if !summary.Passed(cfg, cfg.Count) {
+					t.Fatalf("check failed: %v", summary.FailureMessages())
+				}
+				return
+			}
+			if summary.FirstFailure == nil || !strings.Contains(summary.FirstFailure.Err.Error(), test.wantErr) {
+				t.Fatalf("failures = %v, want one containing %q", summary.FailureMessages(), test.wantErr)
+			}
+			gotHandshake := summary.ErrorCategories[CategoryWebSocketHandshake] == 1
+			if gotHandshake != test.wantHandshake {
+				t.Errorf("handshake failure = %v, want %v, categories: %v", gotHandshake, test.wantHandshake, summary.ErrorCategories)
+			}
+		})
+	}
+}